@@ -0,0 +1,54 @@
+// Command fakesms runs fake SMS gateway, so voting server can be run and tested without real SMS provider.
+//
+// Fake provider is compiled into voting server only with fake build tag, so release builds can not use it.
+// Start such build of voting server with fake provider pointed at the gateway:
+//
+//	go build -tags fake github.com/bilinguliar/gokiezen
+//	gokiezen --provider fake --send_url http://localhost:9090 --insecure_webhook
+//	fakesms --port 9090 --webhook http://localhost:8080/track
+//
+// Then send a vote, check the reply and report its delivery:
+//
+//	curl -d '{"originator": "31612345678", "body": "ABBA"}' localhost:9090/inbound
+//	curl localhost:9090/messages?recipient=31612345678
+//	curl -d '{"id": "<id of the reply>", "status": "delivered"}' localhost:9090/report
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/bilinguliar/gokiezen/msg/fake"
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags)
+
+	var (
+		port          string
+		webhook       string
+		reportWebhook string
+		lookup        string
+	)
+
+	flag.StringVar(&port, "port", "9090", "Port of the gateway")
+	flag.StringVar(&webhook, "webhook", "http://localhost:8080/track", "URL inbound messages are delivered to")
+	flag.StringVar(&reportWebhook, "report_webhook", "http://localhost:8080/dlr", "URL delivery reports are sent to")
+	flag.StringVar(&lookup, "lookup", "", "Comma separated prefix=country pairs used for MSISDN lookup, built-in table if empty")
+
+	flag.Parse()
+
+	var table map[string]string
+	if lookup != "" {
+		var err error
+		if table, err = fake.ParseLookup(lookup); err != nil {
+			log.Fatal("Failed to parse lookup table, error: ", err)
+		}
+	}
+
+	gw := fake.NewGateway(table)
+
+	log.Printf("Fake SMS gateway listens on port %s, delivers inbound messages to %q", port, webhook)
+	log.Fatal(http.ListenAndServe(":"+port, gw.Handler(webhook, reportWebhook)))
+}
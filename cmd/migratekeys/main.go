@@ -0,0 +1,46 @@
+// Command migratekeys moves Redis keys of the legacy schema, where every counter was a top level key,
+// into namespace of the event: gokiezen:{event}:cand:{name}, gokiezen:{event}:country:{code} and so on.
+//
+// Run it once, with the voting server stopped, against the same Redis and with the same event name:
+//
+//	migratekeys --redis_host redis --event WrldDomntn
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mediocregopher/radix.v2/pool"
+
+	"github.com/bilinguliar/gokiezen/score"
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags)
+
+	var (
+		event        string
+		redisHost    string
+		redisPort    string
+		redisConType string
+	)
+
+	flag.StringVar(&event, "event", "WrldDomntn", "Event name that legacy keys belong to")
+	flag.StringVar(&redisHost, "redis_host", "redis", "Redis host")
+	flag.StringVar(&redisPort, "redis_port", "6379", "Redis server port")
+	flag.StringVar(&redisConType, "redis_conn_type", "tcp", "Redis connetction type")
+
+	flag.Parse()
+
+	p, err := pool.New(redisConType, redisHost+":"+redisPort, 1)
+	if err != nil {
+		log.Fatal("Redis pool init failed, error: ", err)
+	}
+
+	moved, err := score.Migrate(p, event)
+	if err != nil {
+		log.Fatalf("Migration failed after %d keys were moved, error: %v", moved, err)
+	}
+
+	log.Printf("Migration finished, %d keys moved to event %q.", moved, event)
+}
@@ -5,14 +5,29 @@
 // But it was built with intention to be quick so there is an option to elect bad presidents really often.
 // Note that you will need to pay for outgoing SMS messages and bad decisions.
 //
-// Current implementation uses Redis as a storage and MessageBird.com as a messaging provider.
-// Outbound messages are sent with limited rate of 1 SMS per second. This is a limitation of current provider.
+// Current implementation uses Redis as a storage and MessageBird.com as a default messaging provider.
+// Twilio, Vonage or any gateway with HTTP API can be selected by flag instead.
+// Outbound messages wait in Redis queue and are sent with limited rate, 1 SMS per second by default.
+// This is a limitation of MessageBird. Messages that were not sent survive restart.
+// Failed messages are retried with growing delay, those that can not be sent are kept as dead letters at /sms/dead
+// where admin can inspect and replay them. Delivery reports are accepted at /dlr, share of delivered replies
+// is reported in stats of every event.
 // It utilizes few MessageBird features: receiving SMS, sending SMS and MSISDN lookup.
 //
 // In order to start Voting you need to add Candidates first. Each candidate can receive votes via short message service.
 // You need to send SMS with candidate’s name on a virtual mobile number (VMN) that can be ordered here: https://dashboard.messagebird.com/app/en/numbers
 //
 // Application exposes an endpoint that will receive POST request with incoming message details.
-// Next it will use MessageBird Lookup API call to determine country associated with this MSISDN.
-// Score will be updates for candidate, country counter will also be incremented.
+// Next it will determine country associated with this MSISDN from its prefix, MessageBird Lookup API call is made
+// only for numbers that can not be resolved offline. Results are cached in Redis and in process, so repeat voters do not cost a lookup.
+// Paid lookup tells mobile operator and type of number as well. Numbers resolved offline have no operator and type,
+// their votes are counted as N/A in stats. Turn on lookup details to complete them with paid lookup
+// and see votes by operator for every voter.
+// Score will be updates for candidate, country, operator and number type counters will also be incremented.
+// Scores of candidates within each country are kept as well, /stats/countries/{code} tells who won in that country.
+// Winner is decided by points, Eurovision style: every country ranks candidates by its televote and gives them points
+// from the table, jury points are added on top. Leaderboard is served on /results.
+// Voter can rank several candidates in one message separated by commas: "ABBA, Lordi, Loreen". Vote goes to the first choice,
+// whole ballot is stored, so /results?method=plurality|approval|borda|irv counts it differently. Instant-runoff returns its rounds too.
+// Votes for candidates that are not registered are counted as invalid, voter gets reply with list of valid candidates.
 package main
@@ -0,0 +1,182 @@
+// Package lookup resolves country, operator and number type of MSISDN. Lookups of SMS provider are paid and slow,
+// so their results are cached in process and in shared store.
+package lookup
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRecentlyFailed is returned when lookup of MSISDN failed recently and it is not repeated yet.
+var ErrRecentlyFailed = errors.New("lookup of MSISDN failed recently")
+
+// Subscriber holds what is known about MSISDN. Operator and Type are empty if enquirer does not tell them.
+type Subscriber struct {
+	Country  string
+	Operator string
+	Type     string
+}
+
+// Enquirer is used to resolve Subscriber by MSISDN.
+type Enquirer interface {
+	Lookup(msisdn string) (Subscriber, error)
+}
+
+// Store keeps encoded lookup results shared by all instances for given time. Failed lookup is stored as empty string.
+// Get returns false if there is no result for MSISDN.
+type Store interface {
+	Get(msisdn string) (string, bool, error)
+	Set(msisdn, data string, ttl time.Duration) error
+}
+
+// Metrics counts how lookups were served.
+type Metrics struct {
+	MemoryHits int64 // Served from in-process cache.
+	StoreHits  int64 // Served from shared store.
+	Misses     int64 // Passed to underlying Enquirer.
+	Negative   int64 // Hits of cached failures, they are counted among memory or store hits as well.
+	Failures   int64 // Misses that failed.
+}
+
+// Cache is Enquirer that remembers results of another one. Recently used results are kept in process,
+// others are read from shared store. Failures are cached for shorter time, so MSISDN that can not be resolved
+// does not cost a lookup on every vote, but is retried soon. It is safe for concurrent use.
+type Cache struct {
+	next        Enquirer
+	store       Store
+	mem         *lru
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+	metrics     Metrics
+}
+
+// NewCache creates Cache in front of given Enquirer. Up to size results are kept in process.
+// Results are cached for ttl, failures for negativeTTL.
+func NewCache(next Enquirer, store Store, size int, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		next:        next,
+		store:       store,
+		mem:         newLRU(size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+	}
+}
+
+// Lookup returns cached result for MSISDN or asks underlying Enquirer.
+func (c *Cache) Lookup(msisdn string) (Subscriber, error) {
+	now := c.now()
+
+	if sub, ok := c.mem.get(msisdn, now); ok {
+		atomic.AddInt64(&c.metrics.MemoryHits, 1)
+		return c.cached(sub)
+	}
+
+	data, ok, err := c.store.Get(msisdn)
+	if err != nil {
+		log.Printf("Failed to read cached lookup of MSISDN: %q, error: %q", msisdn, err)
+	} else if ok {
+		atomic.AddInt64(&c.metrics.StoreHits, 1)
+		sub := decode(data)
+		c.mem.set(msisdn, sub, now.Add(c.ttlOf(sub)))
+		return c.cached(sub)
+	}
+
+	atomic.AddInt64(&c.metrics.Misses, 1)
+
+	sub, err := c.next.Lookup(msisdn)
+	if err != nil {
+		atomic.AddInt64(&c.metrics.Failures, 1)
+		sub = Subscriber{}
+	}
+
+	c.remember(msisdn, sub, now)
+
+	return sub, err
+}
+
+// Metrics returns current values of counters.
+func (c *Cache) Metrics() Metrics {
+	return Metrics{
+		MemoryHits: atomic.LoadInt64(&c.metrics.MemoryHits),
+		StoreHits:  atomic.LoadInt64(&c.metrics.StoreHits),
+		Misses:     atomic.LoadInt64(&c.metrics.Misses),
+		Negative:   atomic.LoadInt64(&c.metrics.Negative),
+		Failures:   atomic.LoadInt64(&c.metrics.Failures),
+	}
+}
+
+// HandleMetrics returns counters of the cache as JSON.
+func (c *Cache) HandleMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(c.Metrics()); err != nil {
+		log.Println("Failed to serialize lookup metrics, error:", err)
+	}
+}
+
+// cached turns cached result into return values of Lookup. Result without country is a cached failure.
+func (c *Cache) cached(sub Subscriber) (Subscriber, error) {
+	if sub.Country == "" {
+		atomic.AddInt64(&c.metrics.Negative, 1)
+		return Subscriber{}, ErrRecentlyFailed
+	}
+
+	return sub, nil
+}
+
+// remember stores result in process and in shared store.
+func (c *Cache) remember(msisdn string, sub Subscriber, now time.Time) {
+	ttl := c.ttlOf(sub)
+
+	c.mem.set(msisdn, sub, now.Add(ttl))
+
+	if err := c.store.Set(msisdn, encode(sub), ttl); err != nil {
+		log.Printf("Failed to cache lookup of MSISDN: %q, error: %q", msisdn, err)
+	}
+}
+
+func (c *Cache) ttlOf(sub Subscriber) time.Duration {
+	if sub.Country == "" {
+		return c.negativeTTL
+	}
+
+	return c.ttl
+}
+
+// encode serializes result for shared store, failure is an empty string.
+func encode(sub Subscriber) string {
+	if sub.Country == "" {
+		return ""
+	}
+
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// decode reads result from shared store, empty string is a cached failure.
+func decode(data string) Subscriber {
+	if data == "" {
+		return Subscriber{}
+	}
+
+	var sub Subscriber
+	if err := json.Unmarshal([]byte(data), &sub); err != nil {
+		log.Printf("Cached lookup %q is broken, error: %q", data, err)
+		return Subscriber{}
+	}
+
+	return sub
+}
@@ -0,0 +1,252 @@
+package lookup
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type EnquirerMock struct {
+	LookupFunc func(msisdn string) (Subscriber, error)
+}
+
+func (e *EnquirerMock) Lookup(msisdn string) (Subscriber, error) {
+	return e.LookupFunc(msisdn)
+}
+
+type StoreMock struct {
+	GetFunc func(msisdn string) (string, bool, error)
+	SetFunc func(msisdn, data string, ttl time.Duration) error
+}
+
+func (s *StoreMock) Get(msisdn string) (string, bool, error) {
+	return s.GetFunc(msisdn)
+}
+
+func (s *StoreMock) Set(msisdn, data string, ttl time.Duration) error {
+	return s.SetFunc(msisdn, data, ttl)
+}
+
+// mapStore is Store that ignores TTL.
+func mapStore(stored map[string]string) *StoreMock {
+	return &StoreMock{
+		GetFunc: func(msisdn string) (string, bool, error) {
+			data, ok := stored[msisdn]
+			return data, ok, nil
+		},
+		SetFunc: func(msisdn, data string, ttl time.Duration) error {
+			stored[msisdn] = data
+			return nil
+		},
+	}
+}
+
+func TestCacheServesRepeatedLookups(t *testing.T) {
+	lookups := 0
+
+	nl := Subscriber{Country: "NL", Operator: "KPN", Type: "mobile"}
+
+	next := &EnquirerMock{
+		LookupFunc: func(msisdn string) (Subscriber, error) {
+			lookups++
+			if msisdn == "999" {
+				return Subscriber{}, errors.New("unknown number")
+			}
+			return nl, nil
+		},
+	}
+
+	ua := Subscriber{Country: "UA", Operator: "Kyivstar", Type: "mobile"}
+	stored := map[string]string{"380661234567": `{"Country":"UA","Operator":"Kyivstar","Type":"mobile"}`}
+	c := NewCache(next, mapStore(stored), 10, time.Hour, time.Minute)
+
+	now := time.Date(2017, 5, 13, 19, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if sub, err := c.Lookup("31612345678"); err != nil || sub != nl {
+			t.Errorf("Subscriber: %+v, error: %v, expected %+v", sub, err, nl)
+		}
+	}
+
+	if sub, err := c.Lookup("380661234567"); err != nil || sub != ua {
+		t.Errorf("Subscriber: %+v, error: %v, expected %+v", sub, err, ua)
+	}
+
+	if sub := decode(stored["31612345678"]); sub != nl {
+		t.Errorf("Stored: %+v, expected %+v", sub, nl)
+	}
+
+	// Failure is cached for short time.
+	if _, err := c.Lookup("999"); err == nil {
+		t.Error("Failed lookup returned no error.")
+	}
+
+	if _, err := c.Lookup("999"); err != ErrRecentlyFailed {
+		t.Errorf("Error: %v, expected %v", err, ErrRecentlyFailed)
+	}
+
+	now = now.Add(2 * time.Minute)
+	delete(stored, "999")
+
+	if _, err := c.Lookup("999"); err == nil || err == ErrRecentlyFailed {
+		t.Errorf("Error: %v, expected lookup to be repeated", err)
+	}
+
+	if lookups != 3 {
+		t.Errorf("Underlying lookup was called %d times, expected %d", lookups, 3)
+	}
+
+	expected := Metrics{MemoryHits: 3, StoreHits: 1, Misses: 3, Negative: 1, Failures: 2}
+	if m := c.Metrics(); m != expected {
+		t.Errorf("Metrics: %+v, expected %+v", m, expected)
+	}
+}
+
+func TestCacheWorksWithoutStore(t *testing.T) {
+	next := &EnquirerMock{
+		LookupFunc: func(msisdn string) (Subscriber, error) {
+			return Subscriber{Country: "SE"}, nil
+		},
+	}
+
+	store := &StoreMock{
+		GetFunc: func(msisdn string) (string, bool, error) {
+			return "", false, errors.New("connection refused")
+		},
+		SetFunc: func(msisdn, data string, ttl time.Duration) error {
+			return errors.New("connection refused")
+		},
+	}
+
+	c := NewCache(next, store, 10, time.Hour, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if sub, err := c.Lookup("46701234567"); err != nil || sub.Country != "SE" {
+			t.Errorf("Country: %q, error: %v, expected %q", sub.Country, err, "SE")
+		}
+	}
+
+	if m := c.Metrics(); m.Misses != 1 || m.MemoryHits != 1 {
+		t.Errorf("Metrics: %+v, expected one miss and one memory hit", m)
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2017, 5, 13, 19, 0, 0, 0, time.UTC)
+	expires := now.Add(time.Hour)
+
+	c := newLRU(2)
+	c.set("a", Subscriber{Country: "NL"}, expires)
+	c.set("b", Subscriber{Country: "UA"}, expires)
+
+	// Reading "a" makes "b" the least recently used one.
+	c.get("a", now)
+	c.set("c", Subscriber{Country: "SE"}, expires)
+
+	if _, ok := c.get("b", now); ok {
+		t.Error("Least recently used entry was not evicted.")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key, now); !ok {
+			t.Errorf("Entry %q was evicted.", key)
+		}
+	}
+
+	if _, ok := c.get("a", expires); ok {
+		t.Error("Expired entry was returned.")
+	}
+}
+
+func TestChainFallsBack(t *testing.T) {
+	paid := 0
+
+	offline := &EnquirerMock{
+		LookupFunc: func(msisdn string) (Subscriber, error) {
+			if msisdn == "31612345678" {
+				return Subscriber{Country: "NL"}, nil
+			}
+			return Subscriber{}, errors.New("unknown prefix")
+		},
+	}
+
+	chain := Chain{
+		offline,
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (Subscriber, error) {
+				paid++
+				if msisdn == "8881234567" {
+					return Subscriber{}, errors.New("not found")
+				}
+				return Subscriber{Country: "XX", Operator: "Thuraya", Type: "mobile"}, nil
+			},
+		},
+	}
+
+	if sub, err := chain.Lookup("31612345678"); err != nil || sub.Country != "NL" || paid != 0 {
+		t.Errorf("Country: %q, error: %v, paid lookups: %d, expected %q without paid lookup", sub.Country, err, paid, "NL")
+	}
+
+	if sub, err := chain.Lookup("88212345678"); err != nil || sub.Operator != "Thuraya" || paid != 1 {
+		t.Errorf("Subscriber: %+v, error: %v, paid lookups: %d, expected operator from paid lookup", sub, err, paid)
+	}
+
+	if _, err := chain.Lookup("8881234567"); err == nil || err.Error() != "not found" {
+		t.Errorf("Error: %v, expected error of the last lookup", err)
+	}
+
+	if _, err := (Chain{}).Lookup("31612345678"); err != ErrNotResolved {
+		t.Errorf("Error: %v, expected %v", err, ErrNotResolved)
+	}
+}
+
+type countryResolver map[string]string
+
+func (r countryResolver) Lookup(msisdn string) (string, error) {
+	if country, ok := r[msisdn]; ok {
+		return country, nil
+	}
+	return "", errors.New("unknown prefix")
+}
+
+func TestCountryOnly(t *testing.T) {
+	en := CountryOnly(countryResolver{"31612345678": "NL"})
+
+	if sub, err := en.Lookup("31612345678"); err != nil || sub != (Subscriber{Country: "NL"}) {
+		t.Errorf("Subscriber: %+v, error: %v, expected country %q only", sub, err, "NL")
+	}
+
+	if _, err := en.Lookup("88212345678"); err == nil {
+		t.Error("Unresolved MSISDN returned no error.")
+	}
+}
+
+func TestWithDetails(t *testing.T) {
+	paid := 0
+
+	en := WithDetails(
+		CountryOnly(countryResolver{"31612345678": "NL", "380661234567": "UA"}),
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (Subscriber, error) {
+				paid++
+				if msisdn == "380661234567" {
+					return Subscriber{}, errors.New("not found")
+				}
+				return Subscriber{Country: "XX", Operator: "KPN", Type: "mobile"}, nil
+			},
+		},
+	)
+
+	if sub, err := en.Lookup("31612345678"); err != nil || sub != (Subscriber{Country: "NL", Operator: "KPN", Type: "mobile"}) {
+		t.Errorf("Subscriber: %+v, error: %v, expected country from offline lookup and details from paid one", sub, err)
+	}
+
+	if sub, err := en.Lookup("380661234567"); err != nil || sub != (Subscriber{Country: "UA"}) {
+		t.Errorf("Subscriber: %+v, error: %v, expected country only", sub, err)
+	}
+
+	if _, err := en.Lookup("88212345678"); err == nil || paid != 2 {
+		t.Errorf("Error: %v, paid lookups: %d, expected error without paid lookup", err, paid)
+	}
+}
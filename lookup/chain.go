@@ -0,0 +1,81 @@
+package lookup
+
+import "errors"
+
+// ErrNotResolved is returned by empty Chain.
+var ErrNotResolved = errors.New("MSISDN was not resolved")
+
+// Chain is Enquirer that asks enquirers in order until one of them resolves MSISDN.
+// Put offline enquirer first and paid lookup after it, so paid lookup is used only for numbers
+// offline one can not resolve. Error of the last enquirer is returned if none of them succeeds.
+type Chain []Enquirer
+
+// Lookup returns result of the first enquirer that resolves MSISDN.
+func (c Chain) Lookup(msisdn string) (Subscriber, error) {
+	err := ErrNotResolved
+
+	for _, en := range c {
+		var sub Subscriber
+		if sub, err = en.Lookup(msisdn); err == nil {
+			return sub, nil
+		}
+	}
+
+	return Subscriber{}, err
+}
+
+// CountryResolver tells only country of MSISDN, like offline numbering plan does.
+type CountryResolver interface {
+	Lookup(msisdn string) (string, error)
+}
+
+// CountryOnly adapts CountryResolver to Enquirer. Operator and type of number stay unknown.
+func CountryOnly(r CountryResolver) Enquirer {
+	return countryOnly{r}
+}
+
+type countryOnly struct {
+	resolver CountryResolver
+}
+
+func (c countryOnly) Lookup(msisdn string) (Subscriber, error) {
+	country, err := c.resolver.Lookup(msisdn)
+	if err != nil {
+		return Subscriber{}, err
+	}
+
+	return Subscriber{Country: country}, nil
+}
+
+// WithDetails completes subscriber resolved by enquirer with operator and type of number from details enquirer.
+// Details are asked only if one of them is missing, offline enquirer tells only country. Country of the first
+// enquirer is kept. If details can not be resolved, subscriber is returned as it is.
+func WithDetails(en, details Enquirer) Enquirer {
+	return withDetails{en: en, details: details}
+}
+
+type withDetails struct {
+	en      Enquirer
+	details Enquirer
+}
+
+func (w withDetails) Lookup(msisdn string) (Subscriber, error) {
+	sub, err := w.en.Lookup(msisdn)
+	if err != nil || sub.Operator != "" && sub.Type != "" {
+		return sub, err
+	}
+
+	more, err := w.details.Lookup(msisdn)
+	if err != nil {
+		return sub, nil
+	}
+
+	if sub.Operator == "" {
+		sub.Operator = more.Operator
+	}
+	if sub.Type == "" {
+		sub.Type = more.Type
+	}
+
+	return sub, nil
+}
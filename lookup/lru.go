@@ -0,0 +1,77 @@
+package lookup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is in-process cache of limited size. The least recently used entry is evicted when it is full.
+// It is safe for concurrent use.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // The most recently used entry is at front.
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	value   Subscriber
+	expires time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns value that has not expired by given time.
+func (c *lru) get(key string, now time.Time) (Subscriber, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return Subscriber{}, false
+	}
+
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return Subscriber{}, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return e.value, true
+}
+
+// set stores value until given time.
+func (c *lru) set(key string, value Subscriber, expires time.Time) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expires: expires})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
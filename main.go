@@ -3,12 +3,17 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mediocregopher/radix.v2/pool"
 
+	"github.com/bilinguliar/gokiezen/lookup"
 	"github.com/bilinguliar/gokiezen/msg"
+	"github.com/bilinguliar/gokiezen/numplan"
 	"github.com/bilinguliar/gokiezen/score"
 	"github.com/bilinguliar/gokiezen/voting"
 )
@@ -17,7 +22,14 @@ const (
 	candidatesEndpoint = "/candidates"
 	statsEndpoint      = "/stats"
 	statsWSEndpoint    = "/stats/ws"
+	countryEndpoint    = "/stats/countries/"
+	resultsEndpoint    = "/results"
 	voteEndpoint       = "/track"
+	eventsEndpoint     = "/events"
+	eventEndpoint      = "/events/"
+	deadSMSEndpoint    = "/sms/dead"
+	reportEndpoint     = msg.ReportPath
+	lookupEndpoint     = "/lookup/metrics"
 	frontend           = "/"
 )
 
@@ -28,67 +40,291 @@ func main() {
 	var (
 		port          string
 		event         string
-		token         string
+		provider      string
+		providerCfg   msg.Config
+		apiKeys       string
+		dedupTTL      time.Duration
+		statusTTL     time.Duration
+		lookupSize    int
+		lookupTTL     time.Duration
+		lookupNegTTL  time.Duration
+		lookupChain   string
+		lookupDetails bool
+		prefixes      string
+		smsRate       float64
+		smsBurst      int
+		smsWorkers    int
+		smsBackoff    msg.Backoff
 		redisHost     string
 		redisPort     string
 		redisConType  string
 		redisPoolSize int
+		matchDistance int
+		policy        voting.Policy
+		scoring       voting.Scoring
+		points        string
+		origins       string
+		jury          string
+		opensAt       string
+		closesAt      string
 	)
 
 	/*
 		According to https://12factor.net the best place to store config - environment variables.
 		Will use this approach.	Env vars will be declared in Dockerfile, startup script will pass them as execution params.
-		Exception is Token. Use secrets to provide this environment variable.
+		Exceptions are Token, API keys and signing key. Use secrets to provide these environment variables.
 	*/
 
 	flag.StringVar(&port, "port", "8080", "Specifies port that server will use to accept connections")
-	flag.StringVar(&event, "event", "WrldDomntn", "Event name. Eurovision for example. 11 symbols max.")
-	flag.StringVar(&token, "token", "", "SMS Gateway API token")
+	flag.StringVar(&event, "event", "WrldDomntn", "Default event name. Eurovision for example. 11 symbols max.")
+	flag.StringVar(&provider, "provider", "messagebird", "SMS provider, one of: "+strings.Join(msg.Providers(), ", "))
+	flag.StringVar(&providerCfg.Token, "token", "", "SMS Gateway API token, auth token of Twilio, API secret of Vonage")
+	flag.StringVar(&providerCfg.Account, "account", "", "Account SID of Twilio or API key of Vonage")
+	flag.StringVar(&apiKeys, "api_keys", "", "Comma separated API keys of admin endpoints in name:role:key format, role is admin or viewer. Stats and results are public")
+	flag.StringVar(&providerCfg.SigningKey, "signing_key", "", "Key used to verify webhook requests, Twilio uses auth token instead")
+	flag.StringVar(&providerCfg.PublicURL, "public_url", "", "Scheme and host SMS provider calls webhook on, taken from request if empty")
+	flag.DurationVar(&providerCfg.Window, "signature_window", 5*time.Minute, "Max age of webhook signature, older requests are rejected as replays")
+	flag.BoolVar(&providerCfg.Insecure, "insecure_webhook", false, "Accept unsigned webhook requests. For local development only")
+	flag.StringVar(&providerCfg.SendURL, "send_url", "", "Endpoint of generic HTTP provider or URL of fake gateway")
+	flag.StringVar(&providerCfg.Template, "send_template", "", "Request body template of generic HTTP provider, gets .Sender, .Recipient and .Text")
+	flag.DurationVar(&dedupTTL, "dedup_ttl", 24*time.Hour, "How long inbound message IDs are remembered to skip retried web-hooks")
+	flag.DurationVar(&statusTTL, "sms_status_ttl", 72*time.Hour, "How long delivery status of outbound SMS is tracked")
+	flag.StringVar(&lookupChain, "lookup", "numplan,provider", "Comma separated MSISDN lookups tried in order: numplan is offline and tells only country, provider is paid and cached and tells operator and number type as well. Operators and types are N/A for numbers resolved by numplan unless lookup_details is set")
+	flag.BoolVar(&lookupDetails, "lookup_details", false, "Complete numbers resolved offline with operator and number type from provider lookup, every new voter costs a paid lookup then. Otherwise their operator and type are counted as N/A in stats")
+	flag.StringVar(&prefixes, "numplan_prefixes", "", "Comma separated prefix=country pairs added to offline numbering plan")
+	flag.IntVar(&lookupSize, "lookup_cache_size", 10000, "Number of MSISDN lookup results cached in process")
+	flag.DurationVar(&lookupTTL, "lookup_ttl", 30*24*time.Hour, "How long lookup result of MSISDN is cached")
+	flag.DurationVar(&lookupNegTTL, "lookup_negative_ttl", 10*time.Minute, "How long failed MSISDN lookup is cached before it is retried")
+	flag.Float64Var(&smsRate, "sms_rate", 1, "Max number of outbound SMS per second, 0 for unlimited")
+	flag.IntVar(&smsBurst, "sms_burst", 1, "Number of outbound SMS that can be sent at once above the rate")
+	flag.IntVar(&smsWorkers, "sms_workers", 2, "Number of outbound SMS sent concurrently, each holds Redis connection")
+	flag.IntVar(&smsBackoff.Attempts, "sms_attempts", 5, "Max number of attempts to send SMS before it becomes dead letter, at least 1")
+	flag.DurationVar(&smsBackoff.Base, "sms_retry_base", 5*time.Second, "Delay before the first retry of failed SMS, doubled with every attempt")
+	flag.DurationVar(&smsBackoff.Max, "sms_retry_max", 10*time.Minute, "Max delay between attempts to send SMS")
 	flag.StringVar(&redisHost, "redis_host", "redis", "Redis host")
 	flag.StringVar(&redisPort, "redis_port", "6379", "Redis server port")
 	flag.StringVar(&redisConType, "redis_conn_type", "tcp", "Redis connetction type")
 	flag.IntVar(&redisPoolSize, "redis_pool_size", 10, "Redis pool size")
+	flag.IntVar(&matchDistance, "match_distance", 2, "Max number of typos in candidate name that still counts as a vote")
+	flag.IntVar(&policy.PerVoter, "votes_per_voter", 0, "Max votes from single MSISDN, 0 for unlimited. Ignored with last_vote_wins")
+	flag.IntVar(&policy.PerCandidate, "votes_per_candidate", 0, "Max votes from single MSISDN for the same candidate, 0 for unlimited")
+	flag.BoolVar(&policy.LastVoteWins, "last_vote_wins", false, "Only the most recent vote from MSISDN counts")
+	flag.StringVar(&opensAt, "opens_at", "", "Opening time of default event in RFC3339 format, opens right away if empty")
+	flag.StringVar(&closesAt, "closes_at", "", "Closing time of default event in RFC3339 format, closed manually if empty")
+	flag.StringVar(&points, "points", "", "Comma separated points each country gives to its top candidates, 12,10,8,7,6,5,4,3,2,1 if empty")
+	flag.BoolVar(&scoring.ExcludeSelf, "exclude_self_votes", false, "Country does not give points to its own candidates")
+	flag.StringVar(&origins, "candidate_countries", "", "Comma separated candidate=country pairs, needed to exclude self votes")
+	flag.StringVar(&jury, "jury", "", "Comma separated jury rankings in country=first|second|third format")
 
 	flag.Parse()
 
-	scoreKeeper := score.NewKeeper(
-		newPool(
-			redisHost+":"+redisPort,
-			redisConType,
-			redisPoolSize,
-		),
+	if smsBackoff.Attempts < 1 {
+		log.Fatal("Max number of attempts to send SMS must be at least 1, got: ", smsBackoff.Attempts)
+	}
+
+	redisPool := newPool(
+		redisHost+":"+redisPort,
+		redisConType,
+		redisPoolSize,
 	)
 
-	msgChan := make(chan msg.Request)
+	smsProvider, err := msg.NewProvider(provider, providerCfg)
+	if err != nil {
+		log.Fatalf("Failed to init SMS provider %q, error: %v", provider, err)
+	}
 
-	birdClient := msg.NewMsgBirdClient(
-		token,
-		msgChan,
-	)
+	// Messages that were being sent when server stopped are sent again.
+	outbox := score.NewOutbox(redisPool)
+	if n, err := outbox.Recover(); err != nil {
+		log.Fatal("Failed to recover outbound SMS queue, error: ", err)
+	} else if n > 0 {
+		log.Printf("%d outbound SMS returned to the queue.", n)
+	}
+
+	deliveries := score.NewDeliveries(redisPool, statusTTL)
+	smsClient := msg.NewClient(smsProvider, outbox, deliveries)
+
+	go msg.StartSendingMessages(context.TODO(), outbox, smsProvider, deliveries, msg.NewLimiter(smsRate, smsBurst), smsBackoff, smsWorkers)
+
+	// Voters vote many times, their MSISDN is looked up once.
+	lookups := lookup.NewCache(providerLookup{smsProvider}, score.NewLookups(redisPool), lookupSize, lookupTTL, lookupNegTTL)
 
-	go msg.StartSendingMessages(context.TODO(), msgChan, birdClient)
+	table, err := numplan.ParsePrefixes(prefixes)
+	if err != nil {
+		log.Fatal("Failed to parse numbering plan prefixes, error: ", err)
+	}
+
+	enquirer, err := newEnquirer(lookupChain, lookup.CountryOnly(numplan.New(table)), lookups)
+	if err != nil {
+		log.Fatal("Failed to configure MSISDN lookup, error: ", err)
+	}
 
-	votingSvc := voting.New(
-		birdClient, // Messenger
-		birdClient, // Enquirer
-		scoreKeeper,
-		event,
+	if lookupDetails {
+		enquirer = lookup.WithDetails(enquirer, lookups)
+	}
+
+	bus := voting.NewBus()
+
+	events := voting.NewEvents(
+		score.NewEvents(redisPool),
+		smsClient,             // Messenger
+		subscribers{enquirer}, // Enquirer
+		bus,
+		func(id string) voting.Storage {
+			return score.NewKeeper(redisPool, id)
+		},
 	)
 
-	candsSvc := voting.NewCandidates(scoreKeeper)
+	if err = events.Load(); err != nil {
+		log.Fatal("Failed to load events, error: ", err)
+	}
 
-	ctrl := voting.NewController(votingSvc, candsSvc)
+	if scoring.Points, err = voting.ParsePoints(points); err != nil {
+		log.Fatal("Failed to parse points table, error: ", err)
+	}
+
+	if scoring.Origins, err = voting.ParseOrigins(origins); err != nil {
+		log.Fatal("Failed to parse candidate countries, error: ", err)
+	}
+
+	if scoring.Jury, err = voting.ParseJury(jury); err != nil {
+		log.Fatal("Failed to parse jury rankings, error: ", err)
+	}
+
+	if err = scoring.Validate(); err != nil {
+		log.Fatal("Self votes can not be excluded without candidate_countries, error: ", err)
+	}
+
+	// Default event is configured by flags, it serves endpoints without event ID.
+	err = events.Add(voting.Event{
+		ID:          event,
+		MaxDistance: matchDistance,
+		Policy:      policy,
+		OpensAt:     parseTime(opensAt),
+		ClosesAt:    parseTime(closesAt),
+		Scoring:     scoring,
+	})
+	if err != nil {
+		log.Fatal("Failed to add default event, error: ", err)
+	}
+
+	if opensAt == "" {
+		openDraft(events, event)
+	}
+
+	keys, err := voting.ParseKeys(apiKeys)
+	if err != nil {
+		log.Fatal("Failed to parse API keys, error: ", err)
+	}
+
+	if len(keys) == 0 {
+		log.Println("No API keys configured, candidates and events can not be managed.")
+	}
 
-	http.HandleFunc(candidatesEndpoint, ctrl.HandleCandidates) // Add/Delete candidates.
-	http.HandleFunc(statsWSEndpoint, ctrl.GetStatsWS)          // Current voting score via WebSocket.
-	http.HandleFunc(statsEndpoint, ctrl.GetStats)              // Voting score via REST API.
-	http.HandleFunc(voteEndpoint, ctrl.HandleVote)             // Web hook that accepts requests from SMS web service.
-	http.HandleFunc(frontend, voting.ServeHTML)                // HTML file handler. Simple page that listens to WebSocket.
+	auth := voting.NewAuth(keys)
+	ctrl := voting.NewController(events, bus, score.NewInbox(redisPool, dedupTTL), inbound{smsProvider}, event)
+
+	http.HandleFunc(candidatesEndpoint, auth.Protect(ctrl.HandleCandidates))                              // Add/Delete candidates.
+	http.HandleFunc(statsWSEndpoint, ctrl.GetStatsWS)                                                     // Current voting score via WebSocket.
+	http.HandleFunc(countryEndpoint, ctrl.GetCountryStats)                                                // Scores of candidates within country.
+	http.HandleFunc(resultsEndpoint, ctrl.GetResults)                                                     // Leaderboard in points or tallied from ballots, tallies are cached.
+	http.HandleFunc(statsEndpoint, ctrl.GetStats)                                                         // Voting score via REST API.
+	http.HandleFunc(voteEndpoint, msg.Protect(smsProvider, ctrl.HandleVote))                              // Web hook that accepts requests from SMS web service.
+	http.HandleFunc(reportEndpoint, msg.Protect(smsProvider, msg.ReportHandler(smsProvider, deliveries))) // Web hook that accepts delivery reports.
+	http.HandleFunc(eventsEndpoint, auth.Protect(ctrl.HandleEvents))                                      // List/Add events.
+	http.HandleFunc(eventEndpoint, auth.ProtectChanges(ctrl.HandleEvent))                                 // Stats, results, candidates and lifecycle of single event, including its WebSocket.
+	http.HandleFunc(deadSMSEndpoint, auth.Protect(msg.DeadLetterHandler(outbox, deliveries)))             // List/Replay SMS that were not sent.
+	http.HandleFunc(lookupEndpoint, auth.Protect(lookups.HandleMetrics))                                  // Hits and misses of MSISDN lookup cache.
+	http.HandleFunc(frontend, voting.ServeHTML)                                                           // HTML file handler. Simple page that listens to WebSocket.
 
 	// TODO handle graceful shutdown.
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// inbound adapts SMS provider to voting. Message types are kept separate, so voting does not depend on msg.
+type inbound struct {
+	provider msg.Provider
+}
+
+func (in inbound) ParseInbound(req *http.Request) (voting.Message, error) {
+	m, err := in.provider.ParseInbound(req)
+	return voting.Message(m), err
+}
+
+// providerLookup adapts lookup of SMS provider to lookup package.
+type providerLookup struct {
+	provider msg.Provider
+}
+
+func (p providerLookup) Lookup(msisdn string) (lookup.Subscriber, error) {
+	sub, err := p.provider.Lookup(msisdn)
+	return lookup.Subscriber(sub), err
+}
+
+// subscribers adapts MSISDN lookups to voting.
+type subscribers struct {
+	enquirer lookup.Enquirer
+}
+
+func (s subscribers) Lookup(msisdn string) (voting.SubscriberInfo, error) {
+	sub, err := s.enquirer.Lookup(msisdn)
+	return voting.SubscriberInfo(sub), err
+}
+
+// newEnquirer builds chain of MSISDN lookups from comma separated names.
+func newEnquirer(names string, offline, provider lookup.Enquirer) (lookup.Enquirer, error) {
+	var chain lookup.Chain
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "numplan":
+			chain = append(chain, offline)
+		case "provider":
+			chain = append(chain, provider)
+		default:
+			return nil, fmt.Errorf("unknown lookup %q", name)
+		}
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
+
+// parseTime parses time in RFC3339 format, empty value is zero time that means no schedule.
+func parseTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("Time %q is not in RFC3339 format, error: %v", value, err)
+	}
+
+	return t
+}
+
+// openDraft opens event that has no opening time right away. Event that was opened before keeps its state,
+// event past its closing time stays in draft until schedule is changed.
+func openDraft(events *voting.Events, id string) {
+	votes, _, ok := events.Get(id)
+	if !ok {
+		return
+	}
+
+	state, err := votes.State()
+	if err != nil || state != voting.Draft {
+		return
+	}
+
+	if err = votes.Open(); err != nil {
+		log.Printf("Event %q was not opened, error: %v", id, err)
+	}
+}
+
 // newPool inits new Redis pool.
 func newPool(url, conType string, poolSize int) *pool.Pool {
 	p, err := pool.New(conType, url, poolSize)
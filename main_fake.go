@@ -0,0 +1,7 @@
+//go:build fake
+// +build fake
+
+package main
+
+// Fake provider is registered only in development builds, it requires insecure_webhook as well.
+import _ "github.com/bilinguliar/gokiezen/msg/fake"
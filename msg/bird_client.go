@@ -1,65 +1,155 @@
 package msg
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"strconv"
+	"time"
 
 	mb "github.com/messagebird/go-rest-api"
 )
 
+// ErrLowBalance is returned when there is not enough credit for a voting campaign.
+var ErrLowBalance = errors.New("balance is too low for proper voting campaign")
+
+// MessageBird error codes that will not go away on retry: request not allowed, missing or invalid parameters,
+// not found and bad request. Not enough balance and internal errors are retried.
+var mbPermanentCodes = map[int]bool{2: true, 9: true, 10: true, 20: true, 21: true, 98: true}
+
 // Birdman or simply aviculturist. Knows how to deal with MessageBird.com API.
 // Wraps original MessageBird client in order to avoid coupling with vendor specific structs in packages that will consume this functionality.
 type Birdman struct {
 	mbClient *mb.Client
-	msgChan  chan Request
+	verifier *Verifier
 }
 
-// NewMsgBirdClient creates instance of Birdman
-func NewMsgBirdClient(token string, mc chan Request) *Birdman {
+// NewMsgBirdClient creates instance of Birdman. Web-hooks are verified with given verifier.
+func NewMsgBirdClient(token string, v *Verifier) (*Birdman, error) {
 	c := &Birdman{
 		mbClient: mb.New(token),
-		msgChan:  mc,
+		verifier: v,
 	}
 
 	balance, err := c.mbClient.Balance()
 	if err != nil {
-		log.Fatal("Unable to get balance")
+		log.Println("Unable to get balance, error:", err)
+		return nil, err
 	}
 
 	if balance.Amount < 1 {
-		log.Fatal("Balance is too low for proper voting campaign")
+		return nil, ErrLowBalance
 	}
 
 	log.Printf("Current MessageBird.com balance type: %q, amount: %f\n", balance.Type, balance.Amount)
 
-	return c
+	return c, nil
+}
+
+func newMessageBird(cfg Config) (Provider, error) {
+	if cfg.SigningKey == "" && !cfg.Insecure {
+		return nil, ErrMissingSigningKey
+	}
+
+	b, err := NewMsgBirdClient(cfg.Token, NewVerifier(cfg.SigningKey, cfg.PublicURL, cfg.Window, cfg.Insecure))
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
 }
 
 // SendText sends SMS from sender to a recipient with provided text.
-func (c *Birdman) SendText(sender, recipient, text string) error {
+// Returns message ID, delivery reports refer to it.
+// Error is permanent if all errors MessageBird responded with are permanent.
+func (c *Birdman) SendText(sender, recipient, text string) (string, error) {
 	m, err := c.mbClient.NewMessage(sender, []string{recipient}, text, &mb.MessageParams{})
 	if err != nil {
-		if err == mb.ErrResponse {
+		if err == mb.ErrResponse && m != nil && len(m.Errors) > 0 {
+			permanent := true
 			for _, mbError := range m.Errors {
 				log.Printf("Error: %#v\n", mbError)
+				permanent = permanent && mbPermanentCodes[mbError.Code]
+			}
+
+			err = fmt.Errorf("messagebird: %s (code %d)", m.Errors[0].Description, m.Errors[0].Code)
+			if permanent {
+				return "", Permanent(err)
 			}
 		}
-		return err
+		return "", err
 	}
 
-	return nil
+	return m.Id, nil
 }
 
-// Lookup is used to get detailes about MSISDN. We need only country code.
-func (c *Birdman) Lookup(msisdn string) (string, error) {
+// Lookup is used to get detailes about MSISDN: country and number type. MessageBird tells operator
+// only as network code of the latest HLR lookup of the number, it is empty if there was none.
+func (c *Birdman) Lookup(msisdn string) (Subscriber, error) {
 	lr, err := c.mbClient.Lookup(msisdn, &mb.LookupParams{})
 	if err != nil {
-		return "", err
+		return Subscriber{}, err
+	}
+
+	sub := Subscriber{Country: lr.CountryCode, Type: numberType(lr.Type)}
+	if lr.HLR != nil && lr.HLR.Network != 0 {
+		sub.Operator = strconv.Itoa(lr.HLR.Network)
+	}
+
+	return sub, nil
+}
+
+// ParseInbound reads inbound SMS forwarded from VMN. MessageBird sends it as GET parameters,
+// as form-encoded POST or as JSON, all of them are accepted. Text comes either as "message" or as "body".
+func (c *Birdman) ParseInbound(req *http.Request) (Inbound, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Inbound{}, err
+	}
+
+	in := Inbound{
+		ID:         param(params, "id"),
+		Originator: param(params, "originator"),
+		Recipient:  param(params, "recipient"),
+		Keyword:    param(params, "keyword"),
+		Body:       firstOf(params, "body", "message"),
+	}
+
+	if in.Originator == "" {
+		return Inbound{}, ErrInvalidInbound
+	}
+
+	if created := param(params, "createdDatetime"); created != "" {
+		if in.Created, err = time.Parse(time.RFC3339, created); err != nil {
+			log.Printf("Creation time of message %q is not valid: %q", in.ID, created)
+		}
+	}
+
+	return in, nil
+}
+
+// ParseReport reads status report MessageBird sends as GET parameters.
+// Reports of buffered messages are followed by final delivered or failed status.
+func (c *Birdman) ParseReport(req *http.Request) (Report, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Report{
+		Ref:    param(params, "id"),
+		Status: reportStatus(param(params, "status"), []string{"delivered"}, []string{"delivery_failed", "expired"}),
+	}
+
+	if r.Ref == "" {
+		return Report{}, ErrInvalidReport
 	}
 
-	return lr.CountryCode, nil
+	return r, nil
 }
 
-// RequestSMS adds SMS request to the channel, it will be send sometime in the future.
-func (c *Birdman) RequestSMS(sender, recipient, text string) {
-	c.msgChan <- Request{Sender: sender, Recipient: recipient, Text: text}
+// VerifyInbound checks MessageBird signature of web-hook request.
+func (c *Birdman) VerifyInbound(req *http.Request) error {
+	return c.verifier.Verify(req)
 }
@@ -0,0 +1,108 @@
+package msg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// DeadLetters stores messages that were not sent, serialized and keyed by message ID.
+// Revive removes dead letter and queues data instead, it returns false if there is no such letter.
+type DeadLetters interface {
+	DeadLetters() (map[string]string, error)
+	Revive(id, data string) (bool, error)
+}
+
+// DeadLetterHandler lists dead letters on GET, the oldest first.
+// POST replays dead letter with ID given as "id" parameter or all of them if ID is omitted.
+// Replayed message is queued again with attempts counted from zero.
+func DeadLetterHandler(d DeadLetters, t Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		letters, err := readDeadLetters(d)
+		if err != nil {
+			log.Println("Failed to read dead letters, error:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if req.Method == "GET" {
+			if err = json.NewEncoder(w).Encode(letters); err != nil {
+				log.Println("Failed to serialize dead letters response, error:", err)
+			}
+			return
+		}
+
+		id := req.FormValue("id")
+		replayed := 0
+
+		for _, l := range letters {
+			if id != "" && l.ID != id {
+				continue
+			}
+
+			ok, err := revive(d, l)
+			if err != nil {
+				log.Printf("Failed to replay dead letter %s, error: %q", l.ID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if ok {
+				replayed++
+				setStatus(t, l.ID, StatusQueued)
+			}
+		}
+
+		if id != "" && replayed == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, `{"replayed":%d}`, replayed)
+	}
+}
+
+// readDeadLetters returns dead letters sorted by failure time. Broken letters are logged and skipped.
+func readDeadLetters(d DeadLetters) ([]DeadLetter, error) {
+	stored, err := d.DeadLetters()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(stored))
+	for id, data := range stored {
+		var l DeadLetter
+		if err = json.Unmarshal([]byte(data), &l); err != nil {
+			log.Printf("Broken dead letter %s skipped: %q, error: %q", id, data, err)
+			continue
+		}
+
+		l.ID = id
+		letters = append(letters, l)
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].Failed.Before(letters[j].Failed)
+	})
+
+	return letters, nil
+}
+
+func revive(d DeadLetters, l DeadLetter) (bool, error) {
+	req := l.Request
+	req.Attempts = 0
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+
+	return d.Revive(l.ID, string(data))
+}
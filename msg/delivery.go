@@ -0,0 +1,91 @@
+package msg
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ReportPath is path of delivery report web-hook. Twilio is asked to call it for every sent message,
+// MessageBird and Vonage must be configured to call it in their dashboards.
+const ReportPath = "/dlr"
+
+// ErrInvalidReport is returned when delivery report can not be parsed.
+var ErrInvalidReport = errors.New("delivery report is not valid")
+
+// Status of outbound message.
+type Status string
+
+// Message is queued first, then it is accepted by provider and finally it is either delivered or failed.
+const (
+	StatusQueued    Status = "queued"
+	StatusSent      Status = "sent"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+// Report is delivery report, it refers to message by ID that provider assigned to it.
+type Report struct {
+	Ref    string
+	Status Status
+}
+
+// Tracker keeps status of outbound messages and counts messages of every event by status.
+// Message is tracked with queued status, Sent sets sent status and remembers reference provider assigned to it,
+// Report changes status by that reference and returns false if there is no such message.
+// Delivered message keeps its status, late reports can not change it.
+type Tracker interface {
+	Track(id, event string) error
+	Sent(id, ref string) error
+	SetStatus(id, status string) error
+	Report(ref, status string) (bool, error)
+}
+
+// ReportHandler updates status of message with delivery report parsed by provider.
+// Report can come before reference of just sent message is recorded, so report of unknown message
+// is answered with not found status and provider sends it again later.
+func ReportHandler(p Provider, t Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		r, err := p.ParseReport(req)
+		if err != nil {
+			log.Println("Failed to parse delivery report, error:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ok, err := t.Report(r.Ref, string(r.Status))
+		if err != nil {
+			log.Printf("Failed to update status of SMS %s, error: %q", r.Ref, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			log.Printf("Delivery report of unknown SMS %s is not accepted yet, status: %s", r.Ref, r.Status)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// reportStatus maps status reported by provider. Statuses that mean neither delivery nor failure,
+// like buffered or accepted, are reported as sent.
+func reportStatus(status string, delivered, failed []string) Status {
+	for _, s := range delivered {
+		if status == s {
+			return StatusDelivered
+		}
+	}
+
+	for _, s := range failed {
+		if status == s {
+			return StatusFailed
+		}
+	}
+
+	return StatusSent
+}
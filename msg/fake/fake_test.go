@@ -0,0 +1,119 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bilinguliar/gokiezen/msg"
+)
+
+func TestProviderThroughGateway(t *testing.T) {
+	p := NewProvider("")
+
+	received := make(chan msg.Inbound, 1)
+
+	// Web-hook of the voting server, it replies to every vote.
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		in, err := p.ParseInbound(req)
+		if err != nil {
+			t.Error("Unexpected error:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received <- in
+
+		if id, err := p.SendText("EuroVision", in.Originator, "Thanks for your vote!"); err != nil || id == "" {
+			t.Errorf("Message ID: %q, error: %v", id, err)
+		}
+	}))
+	defer webhook.Close()
+
+	reports := make(chan msg.Report, 1)
+
+	dlr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r, err := p.ParseReport(req)
+		if err != nil {
+			t.Error("Unexpected error:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reports <- r
+	}))
+	defer dlr.Close()
+
+	gw := NewGateway(map[string]string{"31": "NL", "3197": "ZZ"})
+	srv := httptest.NewServer(gw.Handler(webhook.URL, dlr.URL))
+	defer srv.Close()
+
+	p.url, p.gw = srv.URL, nil
+
+	resp, err := http.Post(srv.URL+InboundPath, "application/json",
+		bytes.NewBufferString(`{"originator": "31612345678", "recipient": "3197004499999", "body": "ABBA"}`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	resp.Body.Close()
+
+	in := <-received
+	if in.ID == "" || in.Created.IsZero() || in.Originator != "31612345678" || in.Body != "ABBA" {
+		t.Errorf("Web-hook got %+v, expected generated ID and creation time", in)
+	}
+
+	resp, err = http.Get(srv.URL + MessagesPath + "?recipient=31612345678")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var sent []Message
+	err = json.NewDecoder(resp.Body).Decode(&sent)
+	resp.Body.Close()
+
+	if err != nil || len(sent) != 1 || sent[0].Text != "Thanks for your vote!" || sent[0].Sender != "EuroVision" {
+		t.Fatalf("Sent messages: %+v, error: %v", sent, err)
+	}
+
+	resp, err = http.Post(srv.URL+ReportPath, "application/json",
+		bytes.NewBufferString(`{"id": "`+sent[0].ID+`", "status": "delivered"}`))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	resp.Body.Close()
+
+	if r := <-reports; r.Ref != sent[0].ID || r.Status != msg.StatusDelivered {
+		t.Errorf("Report: %+v, expected delivery of %s", r, sent[0].ID)
+	}
+
+	for msisdn, expected := range map[string]string{"31612345678": "NL", "3197004499999": "ZZ"} {
+		if sub, err := p.Lookup(msisdn); err != nil || sub.Country != expected {
+			t.Errorf("Country of %s: %q, error: %v, expected %q", msisdn, sub.Country, err, expected)
+		}
+	}
+
+	if _, err = p.Lookup("380661234567"); err != ErrUnknownPrefix {
+		t.Errorf("Error: %v, expected %v", err, ErrUnknownPrefix)
+	}
+}
+
+func TestProviderIsRegistered(t *testing.T) {
+	if _, err := msg.NewProvider("fake", msg.Config{}); err != ErrSecureMode {
+		t.Errorf("Error: %v, expected %v", err, ErrSecureMode)
+	}
+
+	p, err := msg.NewProvider("fake", msg.Config{Insecure: true})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if _, err = p.SendText("EuroVision", "31612345678", "Hello"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if msgs := p.(*Provider).gw.Messages(""); len(msgs) != 1 || msgs[0].Text != "Hello" {
+		t.Errorf("Recorded messages: %+v", msgs)
+	}
+}
@@ -0,0 +1,216 @@
+// Package fake implements SMS gateway that sends nothing, so voting can be run and tested offline.
+//
+// Gateway records outbound messages, tells country of MSISDN from a canned table and fires
+// synthetic inbound web-hooks and delivery reports. It can run in-process or as a separate server, see cmd/fakesms.
+// Provider "fake" talks to such server or, if its URL is not set, to in-process gateway.
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownPrefix is returned by lookup of MSISDN that does not match any prefix of the table.
+	ErrUnknownPrefix = errors.New("no country for MSISDN prefix")
+	// ErrInvalidLookup is returned when lookup table can not be parsed.
+	ErrInvalidLookup = errors.New("invalid lookup table")
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// DefaultLookup maps MSISDN prefixes of few countries to their codes.
+var DefaultLookup = map[string]string{
+	"1":   "US",
+	"31":  "NL",
+	"33":  "FR",
+	"39":  "IT",
+	"44":  "GB",
+	"46":  "SE",
+	"49":  "DE",
+	"380": "UA",
+}
+
+// Message is outbound SMS recorded by gateway.
+type Message struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Recipient string    `json:"recipient"`
+	Text      string    `json:"text"`
+	Sent      time.Time `json:"sent"`
+}
+
+// Inbound is synthetic SMS that gateway delivers to web-hook.
+type Inbound struct {
+	ID              string `json:"id"`
+	Originator      string `json:"originator"`
+	Recipient       string `json:"recipient"`
+	Body            string `json:"body"`
+	CreatedDatetime string `json:"createdDatetime"`
+}
+
+// Gateway records what was sent through it. It is safe for concurrent use.
+type Gateway struct {
+	mu       sync.Mutex
+	messages []Message
+	lookup   map[string]string
+	seq      int
+	started  string
+	now      func() time.Time
+}
+
+// NewGateway creates gateway with given lookup table of MSISDN prefixes, DefaultLookup is used if it is nil.
+func NewGateway(lookup map[string]string) *Gateway {
+	if lookup == nil {
+		lookup = DefaultLookup
+	}
+
+	return &Gateway{
+		lookup:  lookup,
+		started: strconv.FormatInt(time.Now().Unix(), 36),
+		now:     time.Now,
+	}
+}
+
+// Send records outbound message and returns its ID.
+func (g *Gateway) Send(sender, recipient, text string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := g.nextID("fake-out-")
+
+	g.messages = append(g.messages, Message{
+		ID:        id,
+		Sender:    sender,
+		Recipient: recipient,
+		Text:      text,
+		Sent:      g.now(),
+	})
+
+	return id
+}
+
+// Messages returns recorded messages in order they were sent. Messages of all recipients are returned if it is empty.
+func (g *Gateway) Messages(recipient string) []Message {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	list := make([]Message, 0, len(g.messages))
+	for _, m := range g.messages {
+		if recipient == "" || m.Recipient == recipient {
+			list = append(list, m)
+		}
+	}
+
+	return list
+}
+
+// Reset forgets all recorded messages.
+func (g *Gateway) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.messages = nil
+}
+
+// Lookup returns country of the longest prefix that MSISDN starts with.
+func (g *Gateway) Lookup(msisdn string) (string, error) {
+	msisdn = strings.TrimPrefix(msisdn, "+")
+
+	prefixes := make([]string, 0, len(g.lookup))
+	for p := range g.lookup {
+		prefixes = append(prefixes, p)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, p := range prefixes {
+		if strings.HasPrefix(msisdn, p) {
+			return g.lookup[p], nil
+		}
+	}
+
+	return "", ErrUnknownPrefix
+}
+
+// Deliver sends synthetic inbound SMS to web-hook URL as JSON, the way MessageBird does.
+// Missing ID and creation time are generated. Returns ID of the message and status of web-hook response.
+func (g *Gateway) Deliver(webhook string, in Inbound) (string, int, error) {
+	g.mu.Lock()
+	if in.ID == "" {
+		in.ID = g.nextID("fake-in-")
+	}
+	if in.CreatedDatetime == "" {
+		in.CreatedDatetime = g.now().UTC().Format(time.RFC3339)
+	}
+	g.mu.Unlock()
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		return in.ID, 0, err
+	}
+
+	resp, err := httpClient.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return in.ID, 0, err
+	}
+	resp.Body.Close()
+
+	return in.ID, resp.StatusCode, nil
+}
+
+// Report is delivery report that gateway sends to web-hook on request.
+type Report struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// Report sends delivery report of outbound message to web-hook and returns status code it responded with.
+func (g *Gateway) Report(webhook string, r Report) (int, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := httpClient.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// nextID generates message ID. It includes start time of gateway, so IDs are not repeated after restart
+// and web-hook does not skip them as retries. Must be called with lock held.
+func (g *Gateway) nextID(prefix string) string {
+	g.seq++
+	return prefix + g.started + "-" + strconv.Itoa(g.seq)
+}
+
+// ParseLookup parses comma separated list of "prefix=country" pairs.
+func ParseLookup(spec string) (map[string]string, error) {
+	table := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, ErrInvalidLookup
+		}
+
+		table[parts[0]] = parts[1]
+	}
+
+	return table, nil
+}
@@ -0,0 +1,154 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bilinguliar/gokiezen/msg"
+)
+
+// ErrSecureMode is returned when fake provider is configured without insecure web-hooks.
+// It accepts every web-hook, so it must not be turned on by mistake.
+var ErrSecureMode = errors.New("fake provider does not verify web-hooks, it requires insecure mode")
+
+func init() {
+	msg.Register("fake", func(cfg msg.Config) (msg.Provider, error) {
+		if !cfg.Insecure {
+			return nil, ErrSecureMode
+		}
+		return NewProvider(cfg.SendURL), nil
+	})
+}
+
+// Provider is msg.Provider that sends messages to fake gateway. Web-hooks are not signed, every request is accepted.
+type Provider struct {
+	url string
+	gw  *Gateway
+}
+
+// NewProvider creates provider that talks to gateway server at given URL.
+// In-process gateway with default lookup table is used if URL is empty.
+func NewProvider(gatewayURL string) *Provider {
+	p := &Provider{url: gatewayURL}
+	if gatewayURL == "" {
+		p.gw = NewGateway(nil)
+	}
+
+	log.Println("Fake SMS provider is used, messages are not sent and web-hooks are not verified.")
+
+	return p
+}
+
+// SendText records message in the gateway and returns ID gateway assigned to it.
+func (p *Provider) SendText(sender, recipient, text string) (string, error) {
+	if p.gw != nil {
+		id := p.gw.Send(sender, recipient, text)
+		log.Printf("SMS %s from %q to %q: %q", id, sender, recipient, text)
+		return id, nil
+	}
+
+	data, err := json.Marshal(Message{Sender: sender, Recipient: recipient, Text: text})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Post(p.url+SendPath, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("fake gateway: unexpected status %d", resp.StatusCode)
+	}
+
+	var m Message
+	if err = json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return "", err
+	}
+
+	return m.ID, nil
+}
+
+// Lookup returns country from lookup table of the gateway. Fake gateway knows no operators and number types.
+func (p *Provider) Lookup(msisdn string) (msg.Subscriber, error) {
+	if p.gw != nil {
+		country, err := p.gw.Lookup(msisdn)
+		return msg.Subscriber{Country: country}, err
+	}
+
+	resp, err := httpClient.Get(p.url + LookupPath + "?" + url.Values{"msisdn": {msisdn}}.Encode())
+	if err != nil {
+		return msg.Subscriber{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return msg.Subscriber{}, ErrUnknownPrefix
+	}
+
+	var lr struct {
+		CountryCode string `json:"countryCode"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+		return msg.Subscriber{}, err
+	}
+
+	return msg.Subscriber{Country: lr.CountryCode}, nil
+}
+
+// ParseInbound reads JSON web-hook sent by gateway.
+func (p *Provider) ParseInbound(req *http.Request) (msg.Inbound, error) {
+	if req.Method != http.MethodPost {
+		return msg.Inbound{}, msg.ErrInvalidInbound
+	}
+
+	var in Inbound
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		return msg.Inbound{}, err
+	}
+
+	if in.Originator == "" {
+		return msg.Inbound{}, msg.ErrInvalidInbound
+	}
+
+	created, err := time.Parse(time.RFC3339, in.CreatedDatetime)
+	if err != nil {
+		log.Printf("Creation time of message %q is not valid: %q", in.ID, in.CreatedDatetime)
+	}
+
+	return msg.Inbound{
+		ID:         in.ID,
+		Originator: in.Originator,
+		Recipient:  in.Recipient,
+		Body:       in.Body,
+		Created:    created,
+	}, nil
+}
+
+// ParseReport reads JSON delivery report sent by gateway. Status is one of: sent, delivered or failed.
+func (p *Provider) ParseReport(req *http.Request) (msg.Report, error) {
+	var r Report
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		return msg.Report{}, err
+	}
+
+	status := msg.Status(r.Status)
+	if r.ID == "" || (status != msg.StatusSent && status != msg.StatusDelivered && status != msg.StatusFailed) {
+		return msg.Report{}, msg.ErrInvalidReport
+	}
+
+	return msg.Report{Ref: r.ID, Status: status}, nil
+}
+
+// VerifyInbound accepts every request, fake gateway does not sign web-hooks.
+func (p *Provider) VerifyInbound(req *http.Request) error {
+	return nil
+}
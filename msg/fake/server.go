@@ -0,0 +1,124 @@
+package fake
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Endpoints of the gateway server.
+const (
+	SendPath     = "/send"
+	MessagesPath = "/messages"
+	LookupPath   = "/lookup"
+	InboundPath  = "/inbound"
+	ReportPath   = "/report"
+)
+
+// Handler exposes gateway over HTTP. Synthetic inbound messages are delivered to web-hook URL,
+// delivery reports are sent to report web-hook URL.
+//
+//	POST   /send      outbound message {"sender", "recipient", "text"}, used by the fake provider
+//	GET    /messages  recorded messages, optionally of single ?recipient=
+//	DELETE /messages  forget recorded messages
+//	GET    /lookup    country of ?msisdn=
+//	POST   /inbound   deliver {"originator", "recipient", "body"} to web-hook
+//	POST   /report    send {"id", "status"} of outbound message to report web-hook
+func (g *Gateway) Handler(webhook, reportWebhook string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(SendPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var m Message
+		if err := json.NewDecoder(req.Body).Decode(&m); err != nil || m.Recipient == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		id := g.Send(m.Sender, m.Recipient, m.Text)
+		log.Printf("SMS %s from %q to %q: %q", id, m.Sender, m.Recipient, m.Text)
+
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	})
+
+	mux.HandleFunc(MessagesPath, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, g.Messages(req.URL.Query().Get("recipient")))
+		case http.MethodDelete:
+			g.Reset()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc(LookupPath, func(w http.ResponseWriter, req *http.Request) {
+		country, err := g.Lookup(req.URL.Query().Get("msisdn"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"countryCode": country})
+	})
+
+	mux.HandleFunc(InboundPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var in Inbound
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil || in.Originator == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		id, status, err := g.Deliver(webhook, in)
+		if err != nil {
+			log.Printf("Failed to deliver message %s to %q, error: %q", id, webhook, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "status": status})
+	})
+
+	mux.HandleFunc(ReportPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var r Report
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil || r.ID == "" || r.Status == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status, err := g.Report(reportWebhook, r)
+		if err != nil {
+			log.Printf("Failed to report status of message %s to %q, error: %q", r.ID, reportWebhook, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": r.ID, "status": status})
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to write response, error:", err)
+	}
+}
@@ -0,0 +1,198 @@
+package msg
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	genericSecretHeader = "X-Webhook-Secret"
+
+	// defaultTemplate is used when generic provider is configured without template.
+	defaultTemplate = `{"from":{{json .Sender}},"to":{{json .Recipient}},"text":{{json .Text}}}`
+)
+
+// ErrMissingSendURL is returned when generic provider is configured without endpoint.
+var ErrMissingSendURL = errors.New("send URL of HTTP provider is missing")
+
+// templateFuncs escape values for JSON and form templates.
+var templateFuncs = template.FuncMap{
+	"json": func(s string) (string, error) {
+		data, err := json.Marshal(s)
+		return string(data), err
+	},
+	"query": url.QueryEscape,
+}
+
+// Generic sends SMS with HTTP request built from template, so any gateway with HTTP API can be used.
+// Template gets Sender, Recipient and Text. Body that starts with "{" is sent as JSON, otherwise as form.
+// Inbound messages are expected with "id", "from", "to", "text", "keyword" and "created" parameters,
+// web-hook must send shared secret in X-Webhook-Secret header.
+type Generic struct {
+	sendURL  string
+	token    string
+	tmpl     *template.Template
+	secret   string
+	insecure bool
+}
+
+// NewGeneric creates generic HTTP provider. Token, if set, is sent as bearer token.
+func NewGeneric(sendURL, tmpl, token, secret string, insecure bool) (*Generic, error) {
+	if sendURL == "" {
+		return nil, ErrMissingSendURL
+	}
+
+	if tmpl == "" {
+		tmpl = defaultTemplate
+	}
+
+	t, err := template.New("sms").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Generic{
+		sendURL:  sendURL,
+		token:    token,
+		tmpl:     t,
+		secret:   secret,
+		insecure: insecure,
+	}, nil
+}
+
+func newGeneric(cfg Config) (Provider, error) {
+	if cfg.SigningKey == "" && !cfg.Insecure {
+		return nil, ErrMissingSigningKey
+	}
+
+	g, err := NewGeneric(cfg.SendURL, cfg.Template, cfg.Token, cfg.SigningKey, cfg.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// SendText sends SMS from sender to a recipient with provided text.
+// Message ID is taken from "id" field of JSON response, it is empty if endpoint does not respond with one.
+func (g *Generic) SendText(sender, recipient, text string) (string, error) {
+	var body bytes.Buffer
+
+	err := g.tmpl.Execute(&body, struct{ Sender, Recipient, Text string }{sender, recipient, text})
+	if err != nil {
+		return "", err
+	}
+
+	contentType := "application/x-www-form-urlencoded"
+	if bytes.HasPrefix(bytes.TrimSpace(body.Bytes()), []byte("{")) {
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.sendURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return "", statusError(resp.StatusCode, fmt.Errorf("http provider: unexpected status %d", resp.StatusCode))
+	}
+
+	var sr struct {
+		ID json.Number `json:"id"`
+	}
+
+	if isJSON(resp.Header.Get("Content-Type")) && json.NewDecoder(resp.Body).Decode(&sr) == nil {
+		return sr.ID.String(), nil
+	}
+
+	return "", nil
+}
+
+// Lookup is not supported, votes are counted without country.
+func (g *Generic) Lookup(msisdn string) (Subscriber, error) {
+	return Subscriber{}, ErrLookupNotSupported
+}
+
+// ParseInbound reads inbound SMS from GET parameters, form-encoded POST or JSON.
+func (g *Generic) ParseInbound(req *http.Request) (Inbound, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Inbound{}, err
+	}
+
+	in := Inbound{
+		ID:         param(params, "id"),
+		Originator: strings.TrimPrefix(param(params, "from"), "+"),
+		Recipient:  strings.TrimPrefix(param(params, "to"), "+"),
+		Keyword:    param(params, "keyword"),
+		Body:       param(params, "text"),
+	}
+
+	if in.Originator == "" {
+		return Inbound{}, ErrInvalidInbound
+	}
+
+	if created := param(params, "created"); created != "" {
+		if in.Created, err = time.Parse(time.RFC3339, created); err != nil {
+			log.Printf("Creation time of message %q is not valid: %q", in.ID, created)
+		}
+	}
+
+	return in, nil
+}
+
+// ParseReport reads delivery report with "id" and "status" fields from GET parameters, form-encoded POST or JSON.
+// Status is one of: sent, delivered or failed.
+func (g *Generic) ParseReport(req *http.Request) (Report, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Report{
+		Ref:    param(params, "id"),
+		Status: Status(param(params, "status")),
+	}
+
+	if r.Ref == "" || (r.Status != StatusSent && r.Status != StatusDelivered && r.Status != StatusFailed) {
+		return Report{}, ErrInvalidReport
+	}
+
+	return r, nil
+}
+
+// VerifyInbound checks shared secret of web-hook request.
+func (g *Generic) VerifyInbound(req *http.Request) error {
+	secret := req.Header.Get(genericSecretHeader)
+	if secret == "" || g.secret == "" {
+		if g.insecure {
+			return nil
+		}
+		return ErrNoSignature
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(g.secret)) != 1 {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
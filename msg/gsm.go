@@ -0,0 +1,20 @@
+package msg
+
+import "strings"
+
+// gsmAlphabet is the GSM 03.38 default alphabet together with its extension table.
+// Text made of these characters is sent in 7-bit encoding, anything else needs UCS-2 that fits less than half as much into SMS.
+const gsmAlphabet = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà" +
+	"\f^{}\\[~]|€"
+
+// isGSM reports whether text can be sent in GSM 7-bit encoding.
+func isGSM(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(gsmAlphabet, r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,245 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownProvider is returned when there is no provider with requested name.
+	ErrUnknownProvider = errors.New("unknown SMS provider")
+	// ErrInvalidInbound is returned when web-hook request does not carry inbound SMS.
+	ErrInvalidInbound = errors.New("invalid inbound message")
+	// ErrMissingSigningKey is returned when web-hooks can not be verified and insecure mode is not set.
+	ErrMissingSigningKey = errors.New("signing key is required to verify web-hooks")
+	// ErrLookupNotSupported is returned by providers that can not look MSISDN up.
+	ErrLookupNotSupported = errors.New("MSISDN lookup is not supported by provider")
+)
+
+// httpClient is shared by providers that call HTTP API directly.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Inbound is SMS that was sent to one of our numbers.
+type Inbound struct {
+	ID         string    // Assigned by provider, the same message can be delivered more than once.
+	Originator string    // MSISDN of the sender.
+	Recipient  string    // Number (VMN) message was sent to.
+	Keyword    string    // Keyword message was matched by on a shared number, if any.
+	Body       string    // Full text of the message.
+	Created    time.Time // When provider received the message, zero if unknown.
+}
+
+// Number types that lookups of different providers are reduced to.
+const (
+	TypeMobile = "mobile"
+	TypeFixed  = "fixed"
+	TypeVoIP   = "voip"
+	TypeOther  = "other" // Toll free, premium rate, pager and the like.
+)
+
+// Subscriber holds what provider knows about MSISDN. Fields that provider does not report are empty.
+type Subscriber struct {
+	Country  string // ISO 3166-1 alpha-2 code.
+	Operator string // Name or network code of mobile operator.
+	Type     string // One of number types above.
+}
+
+// Provider is SMS gateway. It sends messages, looks MSISDN up and understands its own web-hooks.
+type Provider interface {
+	Messenger
+	Lookup(msisdn string) (Subscriber, error)
+	// ParseInbound reads inbound SMS from web-hook request.
+	ParseInbound(req *http.Request) (Inbound, error)
+	// ParseReport reads delivery report from web-hook request.
+	ParseReport(req *http.Request) (Report, error)
+	// VerifyInbound checks that web-hook request, inbound SMS or delivery report, was sent by provider.
+	VerifyInbound(req *http.Request) error
+}
+
+// Config holds settings of all providers, each provider uses only the ones it needs.
+type Config struct {
+	Token      string        // API token, secret or password.
+	Account    string        // Account ID or API key, if provider needs one besides token.
+	SigningKey string        // Secret used to sign web-hooks.
+	PublicURL  string        // Scheme and host provider calls web-hook on, taken from request if empty.
+	Window     time.Duration // Max age of web-hook signature.
+	Insecure   bool          // Accept unsigned web-hooks. For local development only.
+	SendURL    string        // Endpoint of generic HTTP provider.
+	Template   string        // Request body template of generic HTTP provider.
+}
+
+// Factory creates provider from configuration.
+type Factory func(cfg Config) (Provider, error)
+
+var providers = map[string]Factory{
+	"messagebird": newMessageBird,
+	"twilio":      newTwilio,
+	"vonage":      newVonage,
+	"http":        newGeneric,
+}
+
+// Register adds provider that is implemented outside of this package. It must be called before NewProvider,
+// usually from init function of provider package.
+func Register(name string, f Factory) {
+	providers[name] = f
+}
+
+// NewProvider creates provider with given name.
+func NewProvider(name string, cfg Config) (Provider, error) {
+	f, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return f(cfg)
+}
+
+// Providers returns names of all supported providers.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Protect rejects web-hook requests that were not sent by provider with 401.
+func Protect(p Provider, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := p.VerifyInbound(req); err != nil {
+			log.Printf("Webhook request from %q rejected, error: %q", req.RemoteAddr, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h(w, req)
+	}
+}
+
+// inboundParams returns web-hook parameters. Query is used for GET, form or JSON object for POST.
+// Values of JSON object are converted to strings, keys are kept as they are, see param. Body can be read again, parameters are needed
+// both to verify and to parse request.
+func inboundParams(req *http.Request) (url.Values, error) {
+	switch {
+	case req.Method == http.MethodGet:
+		return req.URL.Query(), nil
+	case req.Method != http.MethodPost:
+		return nil, ErrInvalidInbound
+	case isJSON(req.Header.Get("Content-Type")):
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+
+		// Numbers are kept as they were sent, message IDs and timestamps can be numeric.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		var obj map[string]interface{}
+		if err = dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+
+		params := make(url.Values, len(obj))
+		for k, v := range obj {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				params.Set(k, v)
+			default:
+				params.Set(k, fmt.Sprint(v))
+			}
+		}
+
+		return params, nil
+	default:
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		return req.Form, nil
+	}
+}
+
+// isJSON checks content type of request. JSON is assumed if it is not set, that is how web-hook was called before.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// firstOf returns the first non empty value of given parameters.
+func firstOf(params url.Values, keys ...string) string {
+	for _, k := range keys {
+		if v := param(params, k); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// param returns value of parameter, key is matched ignoring case if there is no exact match.
+// JSON web-hook used to be decoded into struct, so {"Originator": ..., "Body": ...} is accepted as well.
+func param(params url.Values, key string) string {
+	if v, ok := params[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+
+	for k, v := range params {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+// requestURL restores URL that provider called.
+func requestURL(publicURL string, req *http.Request) string {
+	if publicURL != "" {
+		return publicURL + req.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + req.Host + req.URL.RequestURI()
+}
+
+// numberType reduces number type reported by provider to one of known types. Unknown type is empty.
+func numberType(kind string) string {
+	switch strings.ToLower(kind) {
+	case "", "unknown":
+		return ""
+	case "mobile":
+		return TypeMobile
+	case "fixed line", "landline":
+		return TypeFixed
+	case "voip", "virtual":
+		return TypeVoIP
+	default:
+		return TypeOther
+	}
+}
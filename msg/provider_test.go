@@ -0,0 +1,425 @@
+package msg
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readRequest(t *testing.T, file string) *http.Request {
+	f, err := os.Open(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		t.Fatalf("Fixture %s is broken, error: %v", file, err)
+	}
+
+	return req
+}
+
+func TestParseInboundRecordedRequests(t *testing.T) {
+	generic, err := NewGeneric("https://sms.example.com/send", "", "", "s3cret", false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	cases := []struct {
+		file     string
+		provider Provider
+		expected Inbound
+		err      error
+	}{
+		{
+			file:     "messagebird_get.http",
+			provider: &Birdman{},
+			expected: Inbound{
+				ID:         "e8077d803532c0b5937c639b60216938",
+				Originator: "380661234567",
+				Recipient:  "3197004499999",
+				Body:       "ABBA",
+				Created:    time.Date(2017, 5, 13, 19, 0, 2, 0, time.UTC),
+			},
+		},
+		{
+			file:     "messagebird_form.http",
+			provider: &Birdman{},
+			expected: Inbound{
+				ID:         "a1b2c3d4e5f60718293a4b5c6d7e8f90",
+				Originator: "31612345678",
+				Recipient:  "3197004499999",
+				Keyword:    "VOTE",
+				Body:       "VOTE Gigliola Cinquetti",
+				Created:    time.Date(2017, 5, 13, 19, 1, 15, 0, time.UTC),
+			},
+		},
+		{
+			file:     "messagebird_json.http",
+			provider: &Birdman{},
+			expected: Inbound{
+				ID:         "5f2d8a3c1b0e4d7fa9c6b3e2d1f0a987",
+				Originator: "447700900123",
+				Recipient:  "3197004499999",
+				Body:       "Lordi",
+				Created:    time.Date(2017, 5, 13, 19, 2, 40, 0, time.UTC),
+			},
+		},
+		{
+			file:     "messagebird_legacy.http",
+			provider: &Birdman{},
+			expected: Inbound{
+				Originator: "380662556677",
+				Body:       "John",
+			},
+		},
+		{
+			file:     "messagebird_capitalized.http",
+			provider: &Birdman{},
+			expected: Inbound{
+				Originator: "380662556677",
+				Body:       "John",
+			},
+		},
+		{
+			file:     "messagebird_no_originator.http",
+			provider: &Birdman{},
+			err:      ErrInvalidInbound,
+		},
+		{
+			file:     "twilio_form.http",
+			provider: NewTwilio("AC0123456789abcdef0123456789abcdef", "12a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7", "", false),
+			expected: Inbound{
+				ID:         "SM2f1a7e0b3c4d5e6f7a8b9c0d1e2f3a4b",
+				Originator: "380661234567",
+				Recipient:  "3197004499999",
+				Body:       "ABBA",
+			},
+		},
+		{
+			file:     "vonage_get.http",
+			provider: NewVonage("abcd1234", "secret", "vonageSignatureSecret123", time.Minute, false),
+			expected: Inbound{
+				ID:         "0A0000000123ABCD1",
+				Originator: "447700900123",
+				Recipient:  "3197004499999",
+				Keyword:    "LORDI",
+				Body:       "Lordi & co = best",
+				Created:    time.Date(2017, 5, 13, 19, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			file:     "http_json.http",
+			provider: generic,
+			expected: Inbound{
+				ID:         "42",
+				Originator: "380661234567",
+				Recipient:  "3197004499999",
+				Body:       "ABBA",
+				Created:    time.Date(2017, 5, 13, 19, 0, 2, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		in, err := c.provider.ParseInbound(readRequest(t, c.file))
+		if err != c.err {
+			t.Errorf("%s: error %v, expected %v", c.file, err, c.err)
+			continue
+		}
+
+		if !in.Created.Equal(c.expected.Created) {
+			t.Errorf("%s: created %v, expected %v", c.file, in.Created, c.expected.Created)
+		}
+
+		in.Created, c.expected.Created = time.Time{}, time.Time{}
+		if in != c.expected {
+			t.Errorf("%s: message %+v, expected %+v", c.file, in, c.expected)
+		}
+	}
+}
+
+func TestParseReportRecordedRequests(t *testing.T) {
+	cases := []struct {
+		file     string
+		provider Provider
+		expected Report
+	}{
+		{"messagebird_report.http", &Birdman{}, Report{Ref: "e8077d803532c0b5937c639b60216938", Status: StatusDelivered}},
+		{"twilio_report.http", NewTwilio("AC0123456789abcdef0123456789abcdef", "s3cret", "", false),
+			Report{Ref: "SM2f1a7e0b3c4d5e6f7a8b9c0d1e2f3a4b", Status: StatusFailed}},
+		{"vonage_report.http", NewVonage("key", "secret", "s3cret", time.Minute, false),
+			Report{Ref: "0A0000001234567B", Status: StatusSent}},
+	}
+
+	for _, c := range cases {
+		r, err := c.provider.ParseReport(readRequest(t, c.file))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.file, err)
+			continue
+		}
+
+		if r != c.expected {
+			t.Errorf("%s: parsed %+v, expected %+v", c.file, r, c.expected)
+		}
+	}
+}
+
+func TestReportOfUnknownMessageIsRetried(t *testing.T) {
+	tracker := newMemTracker()
+	h := ReportHandler(&Birdman{}, tracker)
+
+	report := func() int {
+		rec := httptest.NewRecorder()
+		h(rec, readRequest(t, "messagebird_report.http"))
+		return rec.Code
+	}
+
+	// Report came before reference of sent message was recorded.
+	if code := report(); code != http.StatusNotFound {
+		t.Errorf("Status of early report: %d, expected %d", code, http.StatusNotFound)
+	}
+
+	tracker.Track("1", "eurovision")
+	tracker.Sent("1", "e8077d803532c0b5937c639b60216938")
+
+	if code := report(); code != http.StatusOK {
+		t.Errorf("Status of retried report: %d, expected %d", code, http.StatusOK)
+	}
+
+	if tracker.count(StatusDelivered) != 1 {
+		t.Errorf("Delivered messages: %d, expected %d", tracker.count(StatusDelivered), 1)
+	}
+}
+
+func TestTwilioVerifyInbound(t *testing.T) {
+	twilio := NewTwilio("AC0123456789abcdef0123456789abcdef", "12a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7", "", false)
+
+	req := readRequest(t, "twilio_form.http")
+	if err := twilio.VerifyInbound(req); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	// Body must still be available to parser.
+	if in, err := twilio.ParseInbound(req); err != nil || in.Body != "ABBA" {
+		t.Errorf("Message after verification: %+v, error: %v", in, err)
+	}
+
+	req = readRequest(t, "twilio_form.http")
+	req.Header.Set("X-Forwarded-Proto", "http")
+	if err := twilio.VerifyInbound(req); err != ErrInvalidSignature {
+		t.Errorf("Error for request to another URL: %v, expected %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestVonageVerifyInbound(t *testing.T) {
+	vonage := NewVonage("abcd1234", "secret", "vonageSignatureSecret123", time.Minute, false)
+	vonage.now = func() time.Time { return time.Unix(1494702010, 0) }
+
+	if err := vonage.VerifyInbound(readRequest(t, "vonage_get.http")); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	req := readRequest(t, "vonage_get.http")
+	q := req.URL.Query()
+	q.Set("text", "ABBA")
+	req.URL.RawQuery = q.Encode()
+
+	if err := vonage.VerifyInbound(req); err != ErrInvalidSignature {
+		t.Errorf("Error for tampered request: %v, expected %v", err, ErrInvalidSignature)
+	}
+
+	vonage.now = func() time.Time { return time.Unix(1494702000, 0).Add(time.Hour) }
+	if err := vonage.VerifyInbound(readRequest(t, "vonage_get.http")); err != ErrExpiredSignature {
+		t.Errorf("Error for replayed request: %v, expected %v", err, ErrExpiredSignature)
+	}
+}
+
+func TestVonageSendsUnicodeOnlyIfNeeded(t *testing.T) {
+	var msgType string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		msgType = req.FormValue("type")
+		io.WriteString(w, `{"messages": [{"message-id": "0A0000000123ABCD1", "status": "0"}]}`)
+	}))
+	defer srv.Close()
+
+	vonage := NewVonage("key", "secret", "s3cret", time.Minute, false)
+	vonage.smsURL = srv.URL
+
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{"Thanks for your vote!", "text"},
+		{"Vote for Måns [12 points] costs €1", "text"},
+		{"Дякуємо за ваш голос!", "unicode"},
+		{"Thanks 🎉", "unicode"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := vonage.SendText("EuroVision", "380661234567", tc.text); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		if msgType != tc.expected {
+			t.Errorf("Text %q sent as %q, expected %q", tc.text, msgType, tc.expected)
+		}
+	}
+}
+
+func TestGenericSendText(t *testing.T) {
+	var (
+		contentType string
+		body        string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentType = req.Header.Get("Content-Type")
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	generic, err := NewGeneric(srv.URL, "", "", "s3cret", false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if _, err = generic.SendText("EuroVision", "380661234567", `Say "hi"`); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	expected := `{"from":"EuroVision","to":"380661234567","text":"Say \"hi\""}`
+	if contentType != "application/json" || body != expected {
+		t.Errorf("Request %s: %s, expected JSON: %s", contentType, body, expected)
+	}
+
+	generic, err = NewGeneric(srv.URL, "src={{query .Sender}}&dst={{query .Recipient}}&msg={{query .Text}}", "", "s3cret", false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if _, err = generic.SendText("EuroVision", "380661234567", "Thanks & bye"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	form, _ := url.ParseQuery(body)
+	if contentType != "application/x-www-form-urlencoded" || form.Get("msg") != "Thanks & bye" {
+		t.Errorf("Request %s: %s, expected form with text", contentType, body)
+	}
+}
+
+func TestSendErrorsAreClassified(t *testing.T) {
+	var (
+		status int
+		body   string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	twilio := NewTwilio("AC123", "s3cret", "", false)
+	twilio.apiURL = srv.URL
+
+	vonage := NewVonage("key", "secret", "s3cret", time.Minute, false)
+	vonage.smsURL = srv.URL
+
+	generic, err := NewGeneric(srv.URL, "", "", "s3cret", false)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	testCases := []struct {
+		name      string
+		messenger Messenger
+		status    int
+		body      string
+		permanent bool
+	}{
+		{"twilio invalid number", twilio, 400, `{"code": 21211, "message": "Invalid 'To' Phone Number"}`, true},
+		{"twilio throttled", twilio, 429, `{"code": 20429, "message": "Too Many Requests"}`, false},
+		{"twilio outage", twilio, 503, "", false},
+		{"vonage invalid params", vonage, 200, `{"messages": [{"status": "3", "error-text": "Invalid to"}]}`, true},
+		{"vonage throttled", vonage, 200, `{"messages": [{"status": "1", "error-text": "Throttled"}]}`, false},
+		{"generic rejected", generic, 422, "", true},
+		{"generic outage", generic, 502, "", false},
+	}
+
+	for _, tc := range testCases {
+		status, body = tc.status, tc.body
+
+		_, err := tc.messenger.SendText("EuroVision", "380661234567", "Hello")
+		if err == nil {
+			t.Errorf("%s: no error", tc.name)
+			continue
+		}
+
+		if IsPermanent(err) != tc.permanent {
+			t.Errorf("%s: error %q permanent: %t, expected %t", tc.name, err, IsPermanent(err), tc.permanent)
+		}
+	}
+}
+
+func TestLookupReportsOperatorAndType(t *testing.T) {
+	var body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	twilio := NewTwilio("AC123", "s3cret", "", false)
+	twilio.lookupURL = srv.URL + "/"
+
+	vonage := NewVonage("key", "secret", "s3cret", time.Minute, false)
+	vonage.insightURL = srv.URL
+
+	testCases := []struct {
+		name     string
+		provider Provider
+		body     string
+		expected Subscriber
+	}{
+		{"twilio mobile", twilio, `{"country_code": "NL", "carrier": {"name": "KPN", "type": "mobile"}}`, Subscriber{"NL", "KPN", TypeMobile}},
+		{"twilio landline", twilio, `{"country_code": "SE", "carrier": {"name": "Telia", "type": "landline"}}`, Subscriber{"SE", "Telia", TypeFixed}},
+		{"twilio without carrier", twilio, `{"country_code": "UA"}`, Subscriber{"UA", "", ""}},
+		{"vonage mobile", vonage, `{"status": 0, "country_code": "GB", "current_carrier": {"name": "Vodafone", "network_type": "mobile"}}`, Subscriber{"GB", "Vodafone", TypeMobile}},
+		{"vonage virtual", vonage, `{"status": 0, "country_code": "US", "current_carrier": {"name": "Bandwidth", "network_type": "virtual"}}`, Subscriber{"US", "Bandwidth", TypeVoIP}},
+		{"vonage toll free", vonage, `{"status": 0, "country_code": "US", "current_carrier": {"name": "AT&T", "network_type": "landline_tollfree"}}`, Subscriber{"US", "AT&T", TypeOther}},
+	}
+
+	for _, tc := range testCases {
+		body = tc.body
+
+		sub, err := tc.provider.Lookup("31612345678")
+		if err != nil || sub != tc.expected {
+			t.Errorf("%s: %+v, error: %v, expected %+v", tc.name, sub, err, tc.expected)
+		}
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider("carrier-pigeon", Config{}); err != ErrUnknownProvider {
+		t.Errorf("Error: %v, expected %v", err, ErrUnknownProvider)
+	}
+
+	if _, err := NewProvider("twilio", Config{Token: "token"}); err != ErrMissingCredentials {
+		t.Errorf("Error: %v, expected %v", err, ErrMissingCredentials)
+	}
+
+	if _, err := NewProvider("http", Config{SendURL: "https://sms.example.com/send"}); err != ErrMissingSigningKey {
+		t.Errorf("Error: %v, expected %v", err, ErrMissingSigningKey)
+	}
+}
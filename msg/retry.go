@@ -0,0 +1,78 @@
+package msg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"net/http"
+	"time"
+)
+
+// permanentError wraps send error that will not go away on retry.
+type permanentError struct {
+	error
+}
+
+// Permanent marks send error that will not go away on retry, for example invalid recipient or rejected credentials.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err}
+}
+
+// IsPermanent reports whether send error is permanent. Other errors, like network failures, are worth retrying.
+func IsPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// statusError classifies error of failed HTTP response. Client errors are permanent,
+// except timeout and throttling, server errors are transient.
+func statusError(status int, err error) error {
+	if status >= http.StatusBadRequest && status < http.StatusInternalServerError &&
+		status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+
+	return err
+}
+
+// Backoff decides when message that failed with transient error is sent again.
+// Delay doubles with every attempt starting from Base up to Max. Random half of it is dropped,
+// so messages that failed at once, for example during provider outage, are not retried at once.
+type Backoff struct {
+	Base     time.Duration
+	Max      time.Duration
+	Attempts int // Message becomes dead letter after that many failed attempts.
+}
+
+// delay returns time to wait before given attempt, first retry is attempt 1.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Base
+	for i := 1; i < attempt && d > 0 && d < b.Max; i++ {
+		d *= 2
+	}
+
+	if d <= 0 || d > b.Max {
+		d = b.Max
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + mrand.Int63n(int64(d)-half))
+}
+
+// newID returns random ID of outbound message.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+
+	return hex.EncodeToString(b)
+}
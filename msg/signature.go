@@ -0,0 +1,206 @@
+package msg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers that MessageBird uses to sign webhook requests.
+// JWT is the current scheme, HMAC signature with timestamp is the legacy one.
+const (
+	signatureJWTHeader = "MessageBird-Signature-JWT"
+	signatureHeader    = "MessageBird-Signature"
+	timestampHeader    = "MessageBird-Request-Timestamp"
+	jwtIssuer          = "MessageBird"
+)
+
+var (
+	// ErrNoSignature is returned when request is not signed.
+	ErrNoSignature = errors.New("webhook request is not signed")
+	// ErrInvalidSignature is returned when signature does not match request or signing key.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrExpiredSignature is returned when request was signed outside of allowed time window, it may be a replay.
+	ErrExpiredSignature = errors.New("webhook signature is expired")
+)
+
+// Verifier checks that webhook request was sent by MessageBird.
+// Both current JWT scheme and legacy HMAC signature with timestamp are supported.
+type Verifier struct {
+	key       []byte
+	publicURL string
+	window    time.Duration
+	insecure  bool
+	now       func() time.Time
+}
+
+// NewVerifier creates Verifier that checks signatures with given signing key.
+// Public URL is scheme and host that MessageBird calls, it is a part of JWT signature. Taken from request if empty.
+// Request signed more than window ago is rejected. In insecure mode unsigned requests are accepted,
+// it is meant for local development only.
+func NewVerifier(signingKey, publicURL string, window time.Duration, insecure bool) *Verifier {
+	return &Verifier{
+		key:       []byte(signingKey),
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		window:    window,
+		insecure:  insecure,
+		now:       time.Now,
+	}
+}
+
+// Verify checks signature of webhook request. Body is read and restored, so it can be read again.
+func (v *Verifier) Verify(req *http.Request) error {
+	token := req.Header.Get(signatureJWTHeader)
+	signature := req.Header.Get(signatureHeader)
+
+	if (token == "" && signature == "") || len(v.key) == 0 {
+		if v.insecure {
+			return nil
+		}
+		return ErrNoSignature
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if token != "" {
+		return v.verifyJWT(token, requestURL(v.publicURL, req), body)
+	}
+
+	return v.verifyHMAC(signature, req.Header.Get(timestampHeader), req.URL.Query().Encode(), body)
+}
+
+// jwtClaims are claims that MessageBird puts into signature.
+type jwtClaims struct {
+	Issuer      string  `json:"iss"`
+	NotBefore   float64 `json:"nbf"`
+	Expiration  float64 `json:"exp"`
+	URLHash     string  `json:"url_hash"`
+	PayloadHash string  `json:"payload_hash"`
+}
+
+// verifyJWT checks token signed with HMAC. URL and body are bound to the token by their SHA-256 hashes.
+func (v *Verifier) verifyJWT(token, url string, body []byte) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidSignature
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return ErrInvalidSignature
+	}
+
+	var h func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		h = sha256.New
+	case "HS384":
+		h = sha512.New384
+	case "HS512":
+		h = sha512.New
+	default:
+		// "none" and asymmetric algorithms are never accepted, signing key is a shared secret.
+		return ErrInvalidSignature
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(h, v.key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return ErrInvalidSignature
+	}
+
+	if claims.Issuer != jwtIssuer || claims.URLHash != sha256Hex([]byte(url)) {
+		return ErrInvalidSignature
+	}
+
+	if (len(body) > 0 && claims.PayloadHash != sha256Hex(body)) || (len(body) == 0 && claims.PayloadHash != "") {
+		return ErrInvalidSignature
+	}
+
+	now := v.now()
+	if now.Add(v.window).Before(unixTime(claims.NotBefore)) || now.Add(-v.window).After(unixTime(claims.Expiration)) {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+// verifyHMAC checks legacy signature. It is HMAC-SHA256 of timestamp, sorted query and SHA-256 of the body
+// separated by new lines.
+func (v *Verifier) verifyHMAC(signature, timestamp, query string, body []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, v.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s", timestamp, query, bodyHash[:])
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	if d := v.now().Sub(time.Unix(ts, 0)); d > v.window || d < -v.window {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// unixTime converts NumericDate of JWT, it may have fractional seconds.
+func unixTime(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
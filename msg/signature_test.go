@@ -0,0 +1,100 @@
+package msg
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "PlLrKaqvZNRR5zAjm42ZT6q1SQxgbbGd"
+
+// fixture is a webhook request recorded at given time.
+type fixture struct {
+	Description string
+	Time        time.Time
+	Method      string
+	URL         string
+	Headers     map[string]string
+	Body        string
+	Error       string // Expected error, empty if request is valid.
+}
+
+func TestVerifyRecordedRequests(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatal("No fixtures found, error:", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var f fixture
+		if err = json.Unmarshal(data, &f); err != nil {
+			t.Fatalf("Fixture %s is broken, error: %v", file, err)
+		}
+
+		req := httptest.NewRequest(f.Method, f.URL, strings.NewReader(f.Body))
+		for k, v := range f.Headers {
+			req.Header.Set(k, v)
+		}
+
+		v := NewVerifier(testSigningKey, "", 5*time.Second, false)
+		v.now = func() time.Time { return f.Time }
+
+		err = v.Verify(req)
+
+		switch {
+		case f.Error == "" && err != nil:
+			t.Errorf("%s (%s): unexpected error: %v", f.Description, file, err)
+		case f.Error != "" && (err == nil || err.Error() != f.Error):
+			t.Errorf("%s (%s): error %v, expected %q", f.Description, file, err, f.Error)
+		}
+
+		if body, _ := io.ReadAll(req.Body); string(body) != f.Body {
+			t.Errorf("%s (%s): body after verification %q, expected %q", f.Description, file, body, f.Body)
+		}
+	}
+}
+
+func TestVerifyInsecureMode(t *testing.T) {
+	req := httptest.NewRequest("POST", "https://vote.example.com/track", strings.NewReader("{}"))
+
+	if err := NewVerifier("", "", time.Second, true).Verify(req); err != nil {
+		t.Error("Unsigned request rejected in insecure mode, error:", err)
+	}
+
+	if err := NewVerifier(testSigningKey, "", time.Second, false).Verify(req); err != ErrNoSignature {
+		t.Errorf("Unsigned request error: %v, expected %v", err, ErrNoSignature)
+	}
+}
+
+func TestVerifyUsesPublicURL(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "jwt_valid.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f fixture
+	if err = json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+
+	// Behind a proxy service sees internal address, public one is configured.
+	req := httptest.NewRequest(f.Method, "http://10.0.0.5:8080/track", strings.NewReader(f.Body))
+	req.Header.Set(signatureJWTHeader, f.Headers[signatureJWTHeader])
+
+	v := NewVerifier(testSigningKey, "https://vote.example.com/", 5*time.Second, false)
+	v.now = func() time.Time { return f.Time }
+
+	if err = v.Verify(req); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
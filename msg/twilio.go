@@ -0,0 +1,230 @@
+package msg
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	twilioAPI          = "https://api.twilio.com/2010-04-01"
+	twilioLookupAPI    = "https://lookups.twilio.com/v1/PhoneNumbers/"
+	twilioSignatureHdr = "X-Twilio-Signature"
+)
+
+// ErrMissingCredentials is returned when provider is configured without credentials it needs.
+var ErrMissingCredentials = errors.New("provider credentials are missing")
+
+// Twilio sends SMS through Twilio.com API. Twilio uses E.164 numbers with plus sign,
+// it is removed from inbound numbers, so MSISDN looks the same for every provider.
+type Twilio struct {
+	sid       string
+	token     string
+	publicURL string
+	insecure  bool
+	apiURL    string
+	lookupURL string
+}
+
+// NewTwilio creates Twilio provider with account SID and auth token. Web-hooks are signed with auth token.
+func NewTwilio(sid, token, publicURL string, insecure bool) *Twilio {
+	return &Twilio{
+		sid:       sid,
+		token:     token,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		insecure:  insecure,
+		apiURL:    twilioAPI,
+		lookupURL: twilioLookupAPI,
+	}
+}
+
+func newTwilio(cfg Config) (Provider, error) {
+	if cfg.Account == "" || cfg.Token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	return NewTwilio(cfg.Account, cfg.Token, cfg.PublicURL, cfg.Insecure), nil
+}
+
+// twilioError is error response of Twilio API.
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// SendText sends SMS from sender to a recipient with provided text. Returns message SID.
+// Delivery reports are requested only if public URL is known, Twilio needs absolute callback URL.
+func (t *Twilio) SendText(sender, recipient, text string) (string, error) {
+	form := url.Values{
+		"From": {sender},
+		"To":   {e164(recipient)},
+		"Body": {text},
+	}
+	if t.publicURL != "" {
+		form.Set("StatusCallback", t.publicURL+ReportPath)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.apiURL+"/Accounts/"+t.sid+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.sid, t.token)
+
+	var sr struct {
+		Sid string `json:"sid"`
+	}
+
+	if err = t.do(req, &sr); err != nil {
+		return "", err
+	}
+
+	return sr.Sid, nil
+}
+
+// Lookup returns country code of MSISDN, its carrier and number type. Carrier information is billed by Twilio per lookup.
+func (t *Twilio) Lookup(msisdn string) (Subscriber, error) {
+	query := url.Values{"Type": {"carrier"}}
+
+	req, err := http.NewRequest(http.MethodGet, t.lookupURL+url.PathEscape(e164(msisdn))+"?"+query.Encode(), nil)
+	if err != nil {
+		return Subscriber{}, err
+	}
+	req.SetBasicAuth(t.sid, t.token)
+
+	var lr struct {
+		CountryCode string `json:"country_code"`
+		Carrier     struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"carrier"`
+	}
+
+	if err = t.do(req, &lr); err != nil {
+		return Subscriber{}, err
+	}
+
+	return Subscriber{Country: lr.CountryCode, Operator: lr.Carrier.Name, Type: numberType(lr.Carrier.Type)}, nil
+}
+
+// ParseInbound reads inbound SMS that Twilio posts as form.
+func (t *Twilio) ParseInbound(req *http.Request) (Inbound, error) {
+	if req.Method != http.MethodPost {
+		return Inbound{}, ErrInvalidInbound
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return Inbound{}, err
+	}
+
+	in := Inbound{
+		ID:         req.PostForm.Get("MessageSid"),
+		Originator: strings.TrimPrefix(req.PostForm.Get("From"), "+"),
+		Recipient:  strings.TrimPrefix(req.PostForm.Get("To"), "+"),
+		Body:       req.PostForm.Get("Body"),
+	}
+
+	if in.Originator == "" {
+		return Inbound{}, ErrInvalidInbound
+	}
+
+	return in, nil
+}
+
+// ParseReport reads status callback Twilio sends as form-encoded POST.
+func (t *Twilio) ParseReport(req *http.Request) (Report, error) {
+	if err := req.ParseForm(); err != nil {
+		return Report{}, err
+	}
+
+	r := Report{
+		Ref:    req.PostForm.Get("MessageSid"),
+		Status: reportStatus(req.PostForm.Get("MessageStatus"), []string{"delivered"}, []string{"undelivered", "failed"}),
+	}
+
+	if r.Ref == "" {
+		return Report{}, ErrInvalidReport
+	}
+
+	return r, nil
+}
+
+// VerifyInbound checks Twilio signature. It is HMAC-SHA1 of full URL followed by sorted form parameters.
+// Signature has no timestamp, retried requests are told apart by message SID.
+func (t *Twilio) VerifyInbound(req *http.Request) error {
+	signature := req.Header.Get(twilioSignatureHdr)
+	if signature == "" {
+		if t.insecure {
+			return nil
+		}
+		return ErrNoSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if err = req.ParseForm(); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(req.PostForm))
+	for k := range req.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(t.token))
+	mac.Write([]byte(requestURL(t.publicURL, req)))
+	for _, k := range keys {
+		for _, v := range req.PostForm[k] {
+			mac.Write([]byte(k + v))
+		}
+	}
+
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// do sends request and decodes response into v. Error response is turned into error.
+func (t *Twilio) do(req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var te twilioError
+		if err = json.NewDecoder(resp.Body).Decode(&te); err != nil || te.Message == "" {
+			return statusError(resp.StatusCode, fmt.Errorf("twilio: unexpected status %d", resp.StatusCode))
+		}
+		return statusError(resp.StatusCode, fmt.Errorf("twilio: %s (code %d)", te.Message, te.Code))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// e164 adds plus sign to MSISDN.
+func e164(msisdn string) string {
+	if strings.HasPrefix(msisdn, "+") {
+		return msisdn
+	}
+
+	return "+" + msisdn
+}
@@ -0,0 +1,269 @@
+package msg
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vonageSMSAPI     = "https://rest.nexmo.com/sms/json"
+	vonageInsightAPI = "https://api.nexmo.com/ni/standard/json"
+	vonageTimeLayout = "2006-01-02 15:04:05"
+)
+
+// Vonage SMS statuses that will not go away on retry: missing or invalid parameters and credentials, invalid message,
+// barred number or account, invalid sender and non-whitelisted destination. Throttling and internal errors are retried.
+var vonagePermanentStatuses = map[string]bool{
+	"2": true, "3": true, "4": true, "6": true, "7": true, "8": true, "11": true, "15": true, "29": true,
+}
+
+// Vonage sends SMS through Vonage (former Nexmo) SMS API.
+type Vonage struct {
+	key        string
+	secret     string
+	sigSecret  string
+	window     time.Duration
+	insecure   bool
+	now        func() time.Time
+	smsURL     string
+	insightURL string
+}
+
+// NewVonage creates Vonage provider with API key and secret. Web-hooks are signed with signature secret.
+func NewVonage(key, secret, sigSecret string, window time.Duration, insecure bool) *Vonage {
+	return &Vonage{
+		key:        key,
+		secret:     secret,
+		sigSecret:  sigSecret,
+		window:     window,
+		insecure:   insecure,
+		now:        time.Now,
+		smsURL:     vonageSMSAPI,
+		insightURL: vonageInsightAPI,
+	}
+}
+
+func newVonage(cfg Config) (Provider, error) {
+	if cfg.Account == "" || cfg.Token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	if cfg.SigningKey == "" && !cfg.Insecure {
+		return nil, ErrMissingSigningKey
+	}
+
+	return NewVonage(cfg.Account, cfg.Token, cfg.SigningKey, cfg.Window, cfg.Insecure), nil
+}
+
+// SendText sends SMS from sender to a recipient with provided text.
+// Text is sent as unicode only if it has characters outside of GSM alphabet, unicode SMS holds less than half as much text.
+// Long text is split into parts, ID of the first part is returned, reports of other parts are not tracked.
+func (v *Vonage) SendText(sender, recipient, text string) (string, error) {
+	msgType := "text"
+	if !isGSM(text) {
+		msgType = "unicode"
+	}
+
+	form := url.Values{
+		"api_key":    {v.key},
+		"api_secret": {v.secret},
+		"from":       {sender},
+		"to":         {recipient},
+		"text":       {text},
+		"type":       {msgType},
+	}
+
+	resp, err := httpClient.PostForm(v.smsURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var sr struct {
+		Messages []struct {
+			ID        string `json:"message-id"`
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return "", statusError(resp.StatusCode, fmt.Errorf("vonage: unexpected response with status %d", resp.StatusCode))
+	}
+
+	// Each part has its own status.
+	for _, m := range sr.Messages {
+		if m.Status != "0" {
+			err = fmt.Errorf("vonage: %s (status %s)", m.ErrorText, m.Status)
+			if vonagePermanentStatuses[m.Status] {
+				return "", Permanent(err)
+			}
+			return "", err
+		}
+	}
+
+	if len(sr.Messages) == 0 {
+		return "", nil
+	}
+
+	return sr.Messages[0].ID, nil
+}
+
+// Lookup returns country code of MSISDN, its current carrier and number type using standard Number Insight.
+// Basic Number Insight is cheaper, but it does not tell carrier.
+func (v *Vonage) Lookup(msisdn string) (Subscriber, error) {
+	query := url.Values{
+		"api_key":    {v.key},
+		"api_secret": {v.secret},
+		"number":     {msisdn},
+	}
+
+	resp, err := httpClient.Get(v.insightURL + "?" + query.Encode())
+	if err != nil {
+		return Subscriber{}, err
+	}
+	defer resp.Body.Close()
+
+	var ir struct {
+		Status         int    `json:"status"`
+		StatusMessage  string `json:"status_message"`
+		CountryCode    string `json:"country_code"`
+		CurrentCarrier struct {
+			Name        string `json:"name"`
+			NetworkType string `json:"network_type"`
+		} `json:"current_carrier"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&ir); err != nil {
+		return Subscriber{}, err
+	}
+
+	if ir.Status != 0 {
+		return Subscriber{}, fmt.Errorf("vonage: %s (status %d)", ir.StatusMessage, ir.Status)
+	}
+
+	return Subscriber{
+		Country:  ir.CountryCode,
+		Operator: ir.CurrentCarrier.Name,
+		Type:     vonageNumberType(ir.CurrentCarrier.NetworkType),
+	}, nil
+}
+
+// vonageNumberType maps network type of Number Insight, landline numbers come in several flavours.
+func vonageNumberType(networkType string) string {
+	if strings.HasPrefix(networkType, "landline_") {
+		return TypeOther
+	}
+
+	return numberType(networkType)
+}
+
+// ParseInbound reads inbound SMS. Vonage sends it as GET parameters, as form-encoded POST or as JSON.
+func (v *Vonage) ParseInbound(req *http.Request) (Inbound, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Inbound{}, err
+	}
+
+	in := Inbound{
+		ID:         params.Get("messageId"),
+		Originator: params.Get("msisdn"),
+		Recipient:  params.Get("to"),
+		Keyword:    params.Get("keyword"),
+		Body:       params.Get("text"),
+	}
+
+	if in.Originator == "" {
+		return Inbound{}, ErrInvalidInbound
+	}
+
+	if ts := params.Get("message-timestamp"); ts != "" {
+		if in.Created, err = time.Parse(vonageTimeLayout, ts); err != nil {
+			log.Printf("Creation time of message %q is not valid: %q", in.ID, ts)
+		}
+	}
+
+	return in, nil
+}
+
+// ParseReport reads delivery receipt. Vonage sends it as GET parameters, form-encoded POST or JSON.
+func (v *Vonage) ParseReport(req *http.Request) (Report, error) {
+	params, err := inboundParams(req)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r := Report{
+		Ref:    params.Get("messageId"),
+		Status: reportStatus(params.Get("status"), []string{"delivered"}, []string{"expired", "failed", "rejected"}),
+	}
+
+	if r.Ref == "" {
+		return Report{}, ErrInvalidReport
+	}
+
+	return r, nil
+}
+
+// VerifyInbound checks signature of web-hook signed with MD5 hash method.
+// Signature is MD5 of sorted parameters in "&key=value" form followed by signature secret.
+// Request with timestamp outside of allowed window is rejected as a replay.
+func (v *Vonage) VerifyInbound(req *http.Request) error {
+	params, err := inboundParams(req)
+	if err != nil {
+		return err
+	}
+
+	sig := params.Get("sig")
+	if sig == "" || v.sigSecret == "" {
+		if v.insecure {
+			return nil
+		}
+		return ErrNoSignature
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != "sig" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// Characters that separate parameters are replaced in values, so they can not be moved between parameters.
+	clean := strings.NewReplacer("&", "_", "=", "_")
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("&" + k + "=" + clean.Replace(params.Get(k)))
+	}
+	b.WriteString(v.sigSecret)
+
+	sum := md5.Sum([]byte(b.String()))
+	expected := hex.EncodeToString(sum[:])
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(sig))) != 1 {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(params.Get("timestamp"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if d := v.now().Sub(time.Unix(ts, 0)); d > v.window || d < -v.window {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
@@ -2,34 +2,199 @@ package msg
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"sync"
+	"time"
 )
 
+// popTimeout is how long worker waits for a message before it checks if it must stop.
+const popTimeout = time.Second
+
 // Request stores SMS details that will be used in NewMessage.
 type Request struct {
+	ID        string
 	Sender    string
 	Recipient string
 	Text      string
+	Attempts  int `json:",omitempty"` // Number of failed attempts to send it.
+}
+
+// DeadLetter is SMS that was not sent because of permanent error or because all attempts failed.
+type DeadLetter struct {
+	Request
+	Error  string
+	Failed time.Time
 }
 
-// Messenger is used to send text messages.
+// Messenger is used to send text messages. SendText returns ID that provider assigned to the message,
+// it is empty if provider does not tell it.
 type Messenger interface {
-	SendText(sender, msisdn, text string) error
+	SendText(sender, msisdn, text string) (string, error)
+}
+
+// Queue stores serialized outbound messages until they are sent. Popped message must be acknowledged
+// when it is handled, message that was not acknowledged in time is sent again, by this or another instance.
+// Instead of acknowledgement, failed message is replaced either with its next attempt that is popped
+// not earlier than given time, or with dead letter kept under message ID.
+type Queue interface {
+	Push(data string) error
+	Pop(timeout time.Duration) (string, error)
+	Ack(data string) error
+	Retry(data, next string, at time.Time) error
+	Bury(data, id, letter string) error
+}
+
+// Client queues messages that are sent by workers in background and asks provider about MSISDN details.
+type Client struct {
+	Provider
+	queue   Queue
+	tracker Tracker
 }
 
-// StartSendingMessages starts background worker that sends short messages.
-func StartSendingMessages(ctx context.Context, mc chan Request, m Messenger) {
-	var req Request
+// NewClient creates Client that adds messages to the queue and tracks their status. Workers must be started to send them.
+func NewClient(p Provider, q Queue, t Tracker) *Client {
+	return &Client{Provider: p, queue: q, tracker: t}
+}
 
-	for {
-		select {
-		case <-ctx.Done():
+// RequestSMS adds SMS request to the queue, it will be send sometime in the future. It does not wait for sending.
+// Message is counted among messages of given event.
+func (c *Client) RequestSMS(event, sender, recipient, text string) {
+	req := Request{ID: newID(), Sender: sender, Recipient: recipient, Text: text}
+
+	if err := c.tracker.Track(req.ID, event); err != nil {
+		log.Printf("Status of SMS %s will not be tracked, error: %q", req.ID, err)
+	}
+
+	data, err := json.Marshal(req)
+	if err == nil {
+		err = c.queue.Push(string(data))
+	}
+
+	if err != nil {
+		log.Printf("SMS to %q was not queued, error: %q", recipient, err)
+	}
+}
+
+// StartSendingMessages starts pool of workers that send queued messages with rate allowed by limiter.
+// Messages that failed with transient error are retried according to backoff.
+// Status of every message is updated in tracker. It returns when context is done and all workers have stopped.
+func StartSendingMessages(ctx context.Context, q Queue, m Messenger, t Tracker, l *Limiter, b Backoff, workers int) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, q, m, t, l, b)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func work(ctx context.Context, q Queue, m Messenger, t Tracker, l *Limiter, b Backoff) {
+	for ctx.Err() == nil {
+		data, err := q.Pop(popTimeout)
+		if err != nil {
+			log.Println("Failed to get SMS from queue, error:", err)
+			pause(ctx, popTimeout)
+			continue
+		}
+
+		if data == "" {
+			continue
+		}
+
+		var req Request
+		if err = json.Unmarshal([]byte(data), &req); err != nil {
+			log.Printf("Broken SMS request dropped: %q, error: %q", data, err)
+			ack(q, data)
+			continue
+		}
+
+		// Message stays unacknowledged if worker is stopped meanwhile, it will be sent again once its lease expires.
+		if err = l.Wait(ctx); err != nil {
 			return
-		case req = <-mc:
-			err := m.SendText(req.Sender, req.Recipient, req.Text)
-			if err != nil {
-				log.Println("Failed to send SMS, error:", err)
-			}
 		}
+
+		ref, err := m.SendText(req.Sender, req.Recipient, req.Text)
+		switch {
+		case err == nil:
+			ack(q, data)
+			sent(t, req.ID, ref)
+		case IsPermanent(err) || req.Attempts+1 >= b.Attempts:
+			bury(q, data, req, err)
+			setStatus(t, req.ID, StatusFailed)
+		default:
+			retry(q, data, req, b, err)
+		}
+	}
+}
+
+// retry queues next attempt of failed message.
+func retry(q Queue, data string, req Request, b Backoff, cause error) {
+	req.Attempts++
+	delay := b.delay(req.Attempts)
+
+	log.Printf("Failed to send SMS %s to %q, attempt %d, retry in %v, error: %q", req.ID, req.Recipient, req.Attempts, delay, cause)
+
+	next, err := json.Marshal(req)
+	if err == nil {
+		err = q.Retry(data, string(next), time.Now().Add(delay))
+	}
+
+	if err != nil {
+		log.Println("Failed to schedule SMS retry, it will be sent again once its lease expires, error:", err)
+	}
+}
+
+// bury replaces failed message with dead letter, it can be inspected and replayed later.
+func bury(q Queue, data string, req Request, cause error) {
+	req.Attempts++
+	log.Printf("Failed to send SMS %s to %q, attempt %d, moved to dead letters, error: %q", req.ID, req.Recipient, req.Attempts, cause)
+
+	letter, err := json.Marshal(DeadLetter{Request: req, Error: cause.Error(), Failed: time.Now()})
+	if err == nil {
+		err = q.Bury(data, req.ID, string(letter))
+	}
+
+	if err != nil {
+		log.Println("Failed to store dead letter, SMS will be sent again once its lease expires, error:", err)
+	}
+}
+
+// sent records reference of sent message, delivery reports will refer to the message by it.
+func sent(t Tracker, id, ref string) {
+	if ref == "" {
+		setStatus(t, id, StatusSent)
+		return
+	}
+
+	if err := t.Sent(id, ref); err != nil {
+		log.Printf("Failed to record status of SMS %s, error: %q", id, err)
+	}
+}
+
+func setStatus(t Tracker, id string, s Status) {
+	if err := t.SetStatus(id, string(s)); err != nil {
+		log.Printf("Failed to record status of SMS %s, error: %q", id, err)
+	}
+}
+
+func ack(q Queue, data string) {
+	if err := q.Ack(data); err != nil {
+		log.Println("Failed to acknowledge SMS, it may be sent again once its lease expires, error:", err)
+	}
+}
+
+// pause waits for given time or until context is done.
+func pause(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
 	}
 }
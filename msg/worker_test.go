@@ -0,0 +1,436 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memQueue is in-memory Queue that keeps popped messages until they are acknowledged.
+// Retries are due right away, dead letters are kept by ID.
+type memQueue struct {
+	mu         sync.Mutex
+	pending    []string
+	processing []string
+	retries    []time.Time
+	dead       map[string]string
+}
+
+func (q *memQueue) Push(data string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, data)
+	return nil
+}
+
+func (q *memQueue) Pop(timeout time.Duration) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return "", nil
+	}
+
+	data := q.pending[0]
+	q.pending = q.pending[1:]
+	q.processing = append(q.processing, data)
+
+	return data, nil
+}
+
+func (q *memQueue) Ack(data string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ack(data)
+	return nil
+}
+
+func (q *memQueue) Retry(data, next string, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ack(data)
+	q.pending = append(q.pending, next)
+	q.retries = append(q.retries, at)
+	return nil
+}
+
+func (q *memQueue) Bury(data, id, letter string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ack(data)
+	if q.dead == nil {
+		q.dead = make(map[string]string)
+	}
+	q.dead[id] = letter
+	return nil
+}
+
+func (q *memQueue) DeadLetters() (map[string]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := make(map[string]string, len(q.dead))
+	for id, l := range q.dead {
+		letters[id] = l
+	}
+	return letters, nil
+}
+
+func (q *memQueue) Revive(id, data string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.dead[id]; !ok {
+		return false, nil
+	}
+
+	delete(q.dead, id)
+	q.pending = append(q.pending, data)
+	return true, nil
+}
+
+func (q *memQueue) ack(data string) {
+	for i, d := range q.processing {
+		if d == data {
+			q.processing = append(q.processing[:i], q.processing[i+1:]...)
+			break
+		}
+	}
+}
+
+// memTracker is in-memory Tracker, it keeps only status of every message.
+type memTracker struct {
+	mu     sync.Mutex
+	status map[string]string
+	refs   map[string]string
+}
+
+func newMemTracker() *memTracker {
+	return &memTracker{status: make(map[string]string), refs: make(map[string]string)}
+}
+
+func (t *memTracker) Track(id, event string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status[id] = string(StatusQueued)
+	return nil
+}
+
+func (t *memTracker) Sent(id, ref string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refs[ref] = id
+	t.status[id] = string(StatusSent)
+	return nil
+}
+
+func (t *memTracker) SetStatus(id, status string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.status[id]; ok {
+		t.status[id] = status
+	}
+	return nil
+}
+
+func (t *memTracker) Report(ref, status string) (bool, error) {
+	t.mu.Lock()
+	id, ok := t.refs[ref]
+	t.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, t.SetStatus(id, status)
+}
+
+// count returns number of messages with given status.
+func (t *memTracker) count(s Status) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, status := range t.status {
+		if status == string(s) {
+			n++
+		}
+	}
+	return n
+}
+
+type MessengerMock struct {
+	SendTextFunc func(sender, msisdn, text string) (string, error)
+}
+
+func (m *MessengerMock) SendText(sender, msisdn, text string) (string, error) {
+	return m.SendTextFunc(sender, msisdn, text)
+}
+
+func TestWorkersSendQueuedMessages(t *testing.T) {
+	q := &memQueue{}
+	tr := newMemTracker()
+	c := NewClient(nil, q, tr)
+
+	for _, r := range []string{"31612345678", "380661234567", "447700900123", "46701234567"} {
+		c.RequestSMS("WrldDomntn", "EuroVision", r, "Thanks for your vote!")
+	}
+
+	var (
+		mu      sync.Mutex
+		sent    = make(map[string]bool)
+		running int
+		maxRun  int
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &MessengerMock{
+		SendTextFunc: func(sender, msisdn, text string) (string, error) {
+			mu.Lock()
+			running++
+			if running > maxRun {
+				maxRun = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			sent[msisdn] = true
+			if len(sent) == 4 {
+				cancel()
+			}
+			mu.Unlock()
+
+			return "ref-" + msisdn, nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		StartSendingMessages(ctx, q, m, tr, NewLimiter(0, 1), Backoff{Attempts: 1}, 2)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Workers did not stop.")
+	}
+
+	if len(sent) != 4 {
+		t.Errorf("Sent %d messages, expected %d", len(sent), 4)
+	}
+
+	if maxRun > 2 {
+		t.Errorf("%d messages were sent concurrently, expected at most %d", maxRun, 2)
+	}
+
+	if len(q.processing) != 0 {
+		t.Errorf("Messages were not acknowledged: %v", q.processing)
+	}
+
+	if n := tr.count(StatusSent); n != 4 {
+		t.Errorf("%d messages have sent status, expected %d", n, 4)
+	}
+
+	if ok, _ := tr.Report("ref-31612345678", string(StatusDelivered)); !ok || tr.count(StatusDelivered) != 1 {
+		t.Error("Delivery report did not find message by reference of provider.")
+	}
+}
+
+func TestWorkersRetryAndBuryFailedMessages(t *testing.T) {
+	q := &memQueue{}
+	tr := newMemTracker()
+	c := NewClient(nil, q, tr)
+
+	c.RequestSMS("WrldDomntn", "EuroVision", "31612345678", "Flaky network")
+	c.RequestSMS("WrldDomntn", "EuroVision", "380661234567", "Invalid recipient")
+	c.RequestSMS("WrldDomntn", "EuroVision", "447700900123", "Recovers")
+
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]int)
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &MessengerMock{
+		SendTextFunc: func(sender, msisdn, text string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			attempts[msisdn]++
+			if attempts["31612345678"] == 3 && attempts["380661234567"] == 1 && attempts["447700900123"] == 2 {
+				defer cancel()
+			}
+
+			switch {
+			case msisdn == "380661234567":
+				return "", Permanent(errors.New("invalid recipient"))
+			case msisdn == "447700900123" && attempts[msisdn] > 1:
+				return "", nil
+			default:
+				return "", errors.New("connection reset")
+			}
+		},
+	}
+
+	b := Backoff{Base: time.Second, Max: time.Minute, Attempts: 3}
+	StartSendingMessages(ctx, q, m, tr, NewLimiter(0, 1), b, 1)
+
+	if len(q.processing) != 0 || len(q.pending) != 0 {
+		t.Errorf("Queue is not empty, processing: %v, pending: %v", q.processing, q.pending)
+	}
+
+	if len(q.retries) != 3 {
+		t.Errorf("%d retries were scheduled, expected %d", len(q.retries), 3)
+	}
+
+	for _, at := range q.retries {
+		if d := time.Until(at); d < 0 || d > 2*time.Second {
+			t.Errorf("Retry is scheduled in %v, expected between backoff base and its double", d)
+		}
+	}
+
+	letters, err := readDeadLetters(q)
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("Dead letters: %+v, error: %v, expected %d letters", letters, err, 2)
+	}
+
+	expected := map[string]int{"31612345678": 3, "380661234567": 1}
+	for _, l := range letters {
+		if l.ID == "" || l.Attempts != expected[l.Recipient] || l.Error == "" || l.Failed.IsZero() {
+			t.Errorf("Dead letter %+v, expected ID, error and %d attempts", l, expected[l.Recipient])
+		}
+	}
+
+	if tr.count(StatusFailed) != 2 || tr.count(StatusSent) != 1 {
+		t.Errorf("Statuses: %v, expected 2 failed and 1 sent message", tr.status)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Base: time.Second, Max: 5 * time.Second}
+
+	testCases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		for i := 0; i < 10; i++ {
+			if d := b.delay(tc.attempt); d < tc.max/2 || d > tc.max {
+				t.Errorf("Delay of attempt %d: %v, expected between %v and %v", tc.attempt, d, tc.max/2, tc.max)
+			}
+		}
+	}
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	q := &memQueue{dead: map[string]string{
+		"a1": `{"Sender": "EuroVision", "Recipient": "31612345678", "Text": "Hi", "Attempts": 5, "Error": "timeout", "Failed": "2017-05-13T19:05:00Z"}`,
+		"b2": `{"Sender": "EuroVision", "Recipient": "380661234567", "Text": "Hi", "Attempts": 1, "Error": "invalid", "Failed": "2017-05-13T19:00:00Z"}`,
+	}}
+
+	tr := newMemTracker()
+	tr.status["a1"] = string(StatusFailed)
+
+	h := DeadLetterHandler(q, tr)
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/sms/dead", nil))
+
+	var letters []DeadLetter
+	if err := json.NewDecoder(w.Body).Decode(&letters); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(letters) != 2 || letters[0].ID != "b2" || letters[1].ID != "a1" {
+		t.Errorf("Dead letters: %+v, expected the oldest first", letters)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/sms/dead?id=c3", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Replay of unknown letter status: %d, expected %d", w.Code, http.StatusNotFound)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/sms/dead?id=a1", nil))
+	if w.Code != http.StatusOK || len(q.dead) != 1 || len(q.pending) != 1 {
+		t.Fatalf("Replay status: %d, dead letters: %v, pending: %v", w.Code, q.dead, q.pending)
+	}
+
+	var req Request
+	if err := json.Unmarshal([]byte(q.pending[0]), &req); err != nil || req.ID != "a1" || req.Attempts != 0 {
+		t.Errorf("Replayed message: %s, error: %v, expected ID a1 without attempts", q.pending[0], err)
+	}
+
+	if tr.status["a1"] != string(StatusQueued) {
+		t.Errorf("Status of replayed message: %q, expected %q", tr.status["a1"], StatusQueued)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/sms/dead", nil))
+	if w.Code != http.StatusOK || len(q.dead) != 0 || len(q.pending) != 2 {
+		t.Errorf("Replay all status: %d, dead letters: %v, pending: %v", w.Code, q.dead, q.pending)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2017, 5, 13, 19, 0, 0, 0, time.UTC)
+
+	l := NewLimiter(2, 2)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	// Full bucket allows burst right away.
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Errorf("Token #%d delayed for %v, expected no delay", i+1, d)
+		}
+	}
+
+	// Next callers are queued one after another.
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("Delay: %v, expected %v", d, 500*time.Millisecond)
+	}
+
+	if d := l.reserve(); d != time.Second {
+		t.Errorf("Delay: %v, expected %v", d, time.Second)
+	}
+
+	// Bucket is refilled with time, but never above burst.
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Errorf("Token #%d after refill delayed for %v, expected no delay", i+1, d)
+		}
+	}
+
+	if d := l.reserve(); d == 0 {
+		t.Error("Token over burst was not delayed.")
+	}
+}
@@ -0,0 +1,125 @@
+// Package numplan resolves country of MSISDN offline, from prefix of its international number.
+//
+// Country is found by the longest matching prefix: country calling code of E.164 number
+// or, for codes shared by several countries like +1 and +7, calling code followed by area code.
+// Ported numbers keep their prefix, so country is resolved right without network lookup.
+package numplan
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidNumber is returned when MSISDN is not a number in international format.
+	ErrInvalidNumber = errors.New("MSISDN is not valid E.164 number")
+	// ErrUnknownPrefix is returned when there is no country for prefix of MSISDN.
+	ErrUnknownPrefix = errors.New("no country for MSISDN prefix")
+	// ErrInvalidPrefixes is returned when list of prefixes can not be parsed.
+	ErrInvalidPrefixes = errors.New("invalid list of prefixes")
+)
+
+// E.164 numbers have up to 15 digits. Shortest numbers in use have country code and 5 to 6 digits.
+const (
+	minDigits = 7
+	maxDigits = 15
+)
+
+// Plan maps number prefixes to country codes. It is safe for concurrent use.
+type Plan struct {
+	prefixes map[string]string
+	longest  int
+}
+
+// New creates Plan with given prefixes, they are added to or override built-in ones.
+func New(prefixes map[string]string) *Plan {
+	p := &Plan{prefixes: make(map[string]string)}
+
+	for _, table := range []map[string]string{countryCodes, areaCodes, prefixes} {
+		for prefix, country := range table {
+			p.add(prefix, country)
+		}
+	}
+
+	return p
+}
+
+// Lookup returns ISO 3166-1 alpha-2 code of country that MSISDN belongs to.
+// Number is accepted with or without leading plus sign or international call prefix 00.
+func (p *Plan) Lookup(msisdn string) (string, error) {
+	number, ok := normalize(msisdn)
+	if !ok {
+		return "", ErrInvalidNumber
+	}
+
+	n := p.longest
+	if n > len(number) {
+		n = len(number)
+	}
+
+	for ; n > 0; n-- {
+		if country, ok := p.prefixes[number[:n]]; ok {
+			return country, nil
+		}
+	}
+
+	return "", ErrUnknownPrefix
+}
+
+func (p *Plan) add(prefix, country string) {
+	p.prefixes[prefix] = country
+	if len(prefix) > p.longest {
+		p.longest = len(prefix)
+	}
+}
+
+// normalize strips international prefix and spaces. Returns false if there is anything but digits left
+// or number is too short or too long.
+func normalize(msisdn string) (string, bool) {
+	number := strings.Replace(strings.TrimSpace(msisdn), " ", "", -1)
+
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	}
+
+	if len(number) < minDigits || len(number) > maxDigits || number[0] == '0' {
+		return "", false
+	}
+
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+
+	return number, true
+}
+
+// ParsePrefixes parses comma separated list of "prefix=country" pairs.
+func ParsePrefixes(spec string) (map[string]string, error) {
+	prefixes := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, ErrInvalidPrefixes
+		}
+
+		prefix := strings.TrimPrefix(strings.TrimSpace(parts[0]), "+")
+		if prefix == "" || strings.Trim(prefix, "0123456789") != "" {
+			return nil, ErrInvalidPrefixes
+		}
+
+		prefixes[prefix] = strings.ToUpper(strings.TrimSpace(parts[1]))
+	}
+
+	return prefixes, nil
+}
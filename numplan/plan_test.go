@@ -0,0 +1,56 @@
+package numplan
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	p := New(map[string]string{"3197": "ZZ"})
+
+	cases := []struct {
+		msisdn  string
+		country string
+		err     error
+	}{
+		{"31612345678", "NL", nil},
+		{"+380661234567", "UA", nil},
+		{"0046701234567", "SE", nil},
+		{"+44 7700 900123", "GB", nil},
+		{"447624123456", "IM", nil},
+		{"12125551234", "US", nil},
+		{"14165551234", "CA", nil},
+		{"18765551234", "JM", nil},
+		{"17871234567", "PR", nil},
+		{"79161234567", "RU", nil},
+		{"77011234567", "KZ", nil},
+		{"3197004499999", "ZZ", nil},
+		{"6831234", "NU", nil},
+		{"0612345678", "", ErrInvalidNumber},
+		{"3161234567890123", "", ErrInvalidNumber},
+		{"31-612345678", "", ErrInvalidNumber},
+		{"EuroVision", "", ErrInvalidNumber},
+		{"8881234567", "", ErrUnknownPrefix},
+	}
+
+	for _, c := range cases {
+		country, err := p.Lookup(c.msisdn)
+		if country != c.country || err != c.err {
+			t.Errorf("%s: country %q, error: %v, expected %q, error: %v", c.msisdn, country, err, c.country, c.err)
+		}
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes(" +3197=zz, 1684=AS ,")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(prefixes) != 2 || prefixes["3197"] != "ZZ" || prefixes["1684"] != "AS" {
+		t.Errorf("Prefixes: %v", prefixes)
+	}
+
+	for _, spec := range []string{"31", "=NL", "31=", "3l=NL"} {
+		if _, err = ParsePrefixes(spec); err != ErrInvalidPrefixes {
+			t.Errorf("%q: error %v, expected %v", spec, err, ErrInvalidPrefixes)
+		}
+	}
+}
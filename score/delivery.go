@@ -0,0 +1,139 @@
+package score
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Status and event of every outbound message are kept in a hash: gokiezen:sms:{id}.
+// Provider's reference points to message ID: gokiezen:smsref:{ref}. Both expire, so reports that come later are dropped.
+// Message can belong to any event, so these keys are outside of event namespace,
+// while every event counts its messages by status in a hash within its namespace: gokiezen:{event}:delivery.
+const (
+	smsPrefix    = namespace + ":sms:"
+	smsRefPrefix = namespace + ":smsref:"
+	deliveryHash = "delivery"
+)
+
+// Statuses that Deliveries sets itself, others are given by caller.
+const (
+	statusQueued = "queued"
+	statusSent   = "sent"
+)
+
+// trackScript starts tracking of queued message.
+// KEYS: message hash, counters of the event. ARGV: event, TTL in seconds, initial status.
+const trackScript = `
+redis.call('HMSET', KEYS[1], 'event', ARGV[1], 'status', ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return redis.call('HINCRBY', KEYS[2], ARGV[3], 1)
+`
+
+// setStatusScript moves message from counter of its current status to counter of the new one.
+// Delivered message keeps its status, so report that comes after it does not change it.
+// KEYS: message hash, counters of its event. ARGV: new status.
+//
+// Returns 0 if message is not tracked.
+const setStatusScript = `
+local cur = redis.call('HGET', KEYS[1], 'status')
+if not cur then
+	return 0
+end
+
+if cur == ARGV[1] or cur == 'delivered' then
+	return 1
+end
+
+redis.call('HSET', KEYS[1], 'status', ARGV[1])
+redis.call('HINCRBY', KEYS[2], cur, -1)
+redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+
+return 1
+`
+
+// Deliveries tracks status of outbound messages in Redis.
+type Deliveries struct {
+	pool ConnectionPool
+	ttl  time.Duration
+}
+
+// NewDeliveries returns pointer to created Deliveries instance. Message is tracked for ttl after it was queued.
+func NewDeliveries(p ConnectionPool, ttl time.Duration) *Deliveries {
+	return &Deliveries{pool: p, ttl: ttl}
+}
+
+// Track starts tracking of queued message sent on behalf of event.
+func (d Deliveries) Track(id, event string) error {
+	return util.LuaEval(d.pool, trackScript, 2, smsPrefix+id, eventKey(event, deliveryHash),
+		event, d.seconds(), statusQueued).Err
+}
+
+// Sent marks message as accepted by provider and remembers reference provider assigned to it.
+func (d Deliveries) Sent(id, ref string) error {
+	if err := d.pool.Cmd(redisSet, smsRefPrefix+ref, id, "EX", d.seconds()).Err; err != nil {
+		return err
+	}
+
+	return d.SetStatus(id, statusSent)
+}
+
+// SetStatus changes status of message. Message that is not tracked is ignored.
+func (d Deliveries) SetStatus(id, status string) error {
+	_, err := d.setStatus(id, status)
+	return err
+}
+
+// Report changes status of message by reference provider assigned to it. Returns false if message is not tracked.
+func (d Deliveries) Report(ref, status string) (bool, error) {
+	resp := d.pool.Cmd(redisGet, smsRefPrefix+ref)
+	if resp.IsType(redis.Nil) {
+		return false, nil
+	}
+
+	id, err := resp.Str()
+	if err != nil {
+		return false, err
+	}
+
+	return d.setStatus(id, status)
+}
+
+// setStatus reads event of the message first to pass its counters to the script. Event of message never changes.
+func (d Deliveries) setStatus(id, status string) (bool, error) {
+	resp := d.pool.Cmd(redisHGet, smsPrefix+id, "event")
+	if resp.IsType(redis.Nil) {
+		return false, nil
+	}
+
+	event, err := resp.Str()
+	if err != nil {
+		return false, err
+	}
+
+	n, err := util.LuaEval(d.pool, setStatusScript, 2, smsPrefix+id, eventKey(event, deliveryHash), status).Int()
+	return n == 1, err
+}
+
+func (d Deliveries) seconds() int {
+	return seconds(d.ttl)
+}
+
+// GetDelivery returns number of outbound messages of the event by their status.
+func (d Keeper) GetDelivery() (map[string]int, error) {
+	stored, err := d.pool.Cmd(redisHGetAll, d.key(deliveryHash)).Map()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(stored))
+	for status, v := range stored {
+		if counts[status], err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,99 @@
+//go:build integration
+// +build integration
+
+package score
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// trackedMessage returns Deliveries and Keeper of the test event with message "1" queued.
+func trackedMessage(t *testing.T) (*Deliveries, *Keeper) {
+	p := testPool(t)
+	d := NewDeliveries(p, time.Hour)
+	if err := d.Track("1", testEvent); err != nil {
+		t.Fatal("Failed to track message, error:", err)
+	}
+
+	return d, NewKeeper(p, testEvent)
+}
+
+func expectDelivery(t *testing.T, k *Keeper, expected map[string]int) {
+	t.Helper()
+
+	counts, err := k.GetDelivery()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Delivery: %v, expected %v", counts, expected)
+	}
+}
+
+func TestDeliveryMovesMessageBetweenCounters(t *testing.T) {
+	d, k := trackedMessage(t)
+	expectDelivery(t, k, map[string]int{"queued": 1})
+
+	if err := d.Sent("1", "ref-1"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expectDelivery(t, k, map[string]int{"queued": 0, "sent": 1})
+
+	// Repeated status is counted once.
+	if err := d.SetStatus("1", "sent"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expectDelivery(t, k, map[string]int{"queued": 0, "sent": 1})
+
+	tracked, err := d.Report("ref-1", "failed")
+	if err != nil || !tracked {
+		t.Fatalf("Report: %v, %v, expected message to be found by reference", tracked, err)
+	}
+	expectDelivery(t, k, map[string]int{"queued": 0, "sent": 0, "failed": 1})
+}
+
+func TestDeliveredStatusIsSticky(t *testing.T) {
+	d, k := trackedMessage(t)
+
+	if err := d.Sent("1", "ref-1"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	// Reports may come out of order, delivered one before the one that message was only sent.
+	for _, status := range []string{"delivered", "sent", "failed"} {
+		if _, err := d.Report("ref-1", status); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	expectDelivery(t, k, map[string]int{"queued": 0, "sent": 0, "delivered": 1})
+
+	// Worker marks message as sent after provider already reported its delivery.
+	if err := d.Sent("1", "ref-1"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	expectDelivery(t, k, map[string]int{"queued": 0, "sent": 0, "delivered": 1})
+}
+
+func TestDeliveryIgnoresUntrackedMessages(t *testing.T) {
+	d, k := trackedMessage(t)
+
+	tracked, err := d.Report("unknown", "delivered")
+	if err != nil || tracked {
+		t.Errorf("Report of unknown reference: %v, %v, expected message not to be found", tracked, err)
+	}
+
+	// Message whose tracking expired, while its reference is still kept.
+	if err = d.Sent("2", "ref-2"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	tracked, err = d.Report("ref-2", "delivered")
+	if err != nil || tracked {
+		t.Errorf("Report of untracked message: %v, %v, expected message not to be found", tracked, err)
+	}
+
+	expectDelivery(t, k, map[string]int{"queued": 1})
+}
@@ -0,0 +1,31 @@
+package score
+
+// eventsHash stores configuration of every event by its ID. It is outside of event namespace, like inbox.
+const eventsHash = namespace + ":events"
+
+// Events persists configuration of voting events in Redis.
+type Events struct {
+	pool ConnectionPool
+}
+
+// NewEvents returns pointer to created Events instance initialized with Redis pool.
+func NewEvents(p ConnectionPool) *Events {
+	return &Events{pool: p}
+}
+
+// SaveEvent stores serialized event configuration, previous one is overwritten.
+func (e Events) SaveEvent(id, data string) error {
+	_, err := e.pool.Cmd(redisHSet, eventsHash, id, data).Int()
+	return err
+}
+
+// RemoveEvent deletes event configuration. Score of the event is kept.
+func (e Events) RemoveEvent(id string) error {
+	_, err := e.pool.Cmd(redisHDel, eventsHash, id).Int()
+	return err
+}
+
+// GetEvents returns serialized configuration of all events by ID.
+func (e Events) GetEvents() (map[string]string, error) {
+	return e.pool.Cmd(redisHGetAll, eventsHash).Map()
+}
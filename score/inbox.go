@@ -0,0 +1,81 @@
+package score
+
+import (
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// inboxPrefix namespaces IDs of inbound messages. IDs are assigned by SMS service,
+// message can belong to any event, so they are outside of event namespace.
+const inboxPrefix = namespace + ":inbox:"
+
+const redisDel = "DEL"
+
+// States of inbound message. Message is processing until its vote is stored, done after that.
+const (
+	MessageProcessing = "processing"
+	MessageDone       = "done"
+)
+
+// processingTTL limits how long message stays processing. If instance dies meanwhile, retry is processed after it.
+const processingTTL = time.Minute
+
+// Inbox remembers IDs of inbound messages for a limited time, so retried web-hook is processed once.
+type Inbox struct {
+	pool ConnectionPool
+	ttl  time.Duration
+}
+
+// NewInbox returns pointer to created Inbox instance. ID of processed message is remembered for ttl.
+func NewInbox(p ConnectionPool, ttl time.Duration) *Inbox {
+	return &Inbox{pool: p, ttl: ttl}
+}
+
+// Claim marks message as processing. Returns state message was in before, empty string if it is claimed now.
+// Messages marked before states were kept are reported as done.
+func (i Inbox) Claim(id string) (string, error) {
+	resp := i.pool.Cmd(redisSet, inboxPrefix+id, MessageProcessing, "EX", seconds(processingTTL), "NX")
+	if !resp.IsType(redis.Nil) {
+		_, err := resp.Str()
+		return "", err
+	}
+
+	resp = i.pool.Cmd(redisGet, inboxPrefix+id)
+	if resp.IsType(redis.Nil) {
+		// Marker expired meanwhile, message is going to be claimed by the next retry.
+		return MessageProcessing, nil
+	}
+
+	state, err := resp.Str()
+	if err != nil {
+		return "", err
+	}
+
+	if state != MessageProcessing {
+		state = MessageDone
+	}
+
+	return state, nil
+}
+
+// Done marks message as processed, it is remembered for ttl of the inbox.
+func (i Inbox) Done(id string) error {
+	return i.pool.Cmd(redisSet, inboxPrefix+id, MessageDone, "EX", seconds(i.ttl)).Err
+}
+
+// Release forgets message, so it is processed again when web-hook is retried.
+func (i Inbox) Release(id string) error {
+	_, err := i.pool.Cmd(redisDel, inboxPrefix+id).Int()
+	return err
+}
+
+// seconds rounds expiration time down to seconds, but not below one second, Redis rejects zero.
+func seconds(ttl time.Duration) int {
+	secs := int(ttl / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	return secs
+}
@@ -1,17 +1,51 @@
 package score
 
-import "github.com/mediocregopher/radix.v2/redis"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Every key is prefixed with namespace and event name: gokiezen:{event}:cand:{name}.
+// So candidate named like country code or like one of the sets does not collide with them.
+const (
+	namespace     = "gokiezen"
+	countries     = "countries"
+	parties       = "candidates"
+	invalid       = "invalid"
+	aliases       = "aliases"
+	rejected      = "rejected"
+	candPrefix    = "cand"
+	countryPrefix = "country"
+	operators     = "operators"
+	numTypes      = "types"
+	opPrefix      = "operator"
+	typePrefix    = "type"
+
+	countryCandsPrefix = "bycountry"
+)
+
+// mgetBatch limits number of keys requested by single MGET, so huge request does not block Redis.
+const mgetBatch = 500
 
 // Listing of Redis commands that we need to work with sets.
 const (
-	countries = "ALL_COUNTRIES"
-	parties   = "ALL_PARTIES"
-
-	redisGet      = "GET"
-	redisIncr     = "INCR"
-	redisSAdd     = "SADD"
-	redisSRem     = "SREM"
-	redisSMembers = "SMEMBERS"
+	redisGet       = "GET"
+	redisIncr      = "INCR"
+	redisSAdd      = "SADD"
+	redisSRem      = "SREM"
+	redisSMembers  = "SMEMBERS"
+	redisSScan     = "SSCAN"
+	redisHScan     = "HSCAN"
+	redisMGet      = "MGET"
+	redisSIsMember = "SISMEMBER"
+	redisHSet      = "HSET"
+	redisHDel      = "HDEL"
+	redisHGet      = "HGET"
+	redisHGetAll   = "HGETALL"
+	redisHMGet     = "HMGET"
 )
 
 // ConnectionPool used to make requests to Redis. Its size is provided by Configuration during application init.
@@ -20,49 +54,238 @@ type ConnectionPool interface {
 }
 
 // Keeper is an implemetation of ScoreKeeper that uses Redis.
+// Each event has its own Keeper, data of different events is isolated by key prefix.
 type Keeper struct {
-	pool ConnectionPool
+	pool  ConnectionPool
+	event string
 }
 
-// NewKeeper returns pointer to created Keeper instance initialized with Redis pool.
-func NewKeeper(p ConnectionPool) *Keeper {
-	return &Keeper{pool: p}
+// NewKeeper returns pointer to created Keeper instance initialized with Redis pool and event name.
+func NewKeeper(p ConnectionPool, event string) *Keeper {
+	return &Keeper{pool: p, event: event}
 }
 
-// Get returns current score for given key.
-func (d Keeper) Get(key string) (int, error) {
-	return d.pool.Cmd(redisGet, key).Int()
+// GetCandidateScore returns current score of candidate. Candidate without votes has score of zero.
+func (d Keeper) GetCandidateScore(p string) (int, error) {
+	return d.get(d.key(candPrefix, p))
 }
 
-// AddPoint increments counter by one for a given key.
-func (d Keeper) AddPoint(key string) error {
-	_, err := d.pool.Cmd(redisIncr, key).Int()
-	return err
+// GetCountryScore returns number of votes from given country.
+func (d Keeper) GetCountryScore(c string) (int, error) {
+	return d.get(d.key(countryPrefix, c))
+}
+
+// GetCandidateScores returns current score of every given candidate within single round trip.
+func (d Keeper) GetCandidateScores(names []string) (map[string]int, error) {
+	return d.getPrefixed(candPrefix, names)
+}
+
+// GetCountryScores returns number of votes from every given country within single round trip.
+func (d Keeper) GetCountryScores(codes []string) (map[string]int, error) {
+	return d.getPrefixed(countryPrefix, codes)
+}
+
+// GetOperatorScores returns number of votes from subscribers of every given operator within single round trip.
+func (d Keeper) GetOperatorScores(names []string) (map[string]int, error) {
+	return d.getPrefixed(opPrefix, names)
+}
+
+// GetTypeScores returns number of votes from every given type of number within single round trip.
+func (d Keeper) GetTypeScores(types []string) (map[string]int, error) {
+	return d.getPrefixed(typePrefix, types)
+}
+
+// GetMany returns values of counters stored under given keys. Counter that was never incremented is zero.
+// Keys are requested with MGET, so number of round trips does not depend on number of keys unless there are thousands of them.
+func (d Keeper) GetMany(keys []string) (map[string]int, error) {
+	values := make(map[string]int, len(keys))
+
+	for start := 0; start < len(keys); start += mgetBatch {
+		end := start + mgetBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		args := make([]interface{}, 0, end-start)
+		for _, k := range keys[start:end] {
+			args = append(args, k)
+		}
+
+		resps, err := d.pool.Cmd(redisMGet, args...).Array()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, r := range resps {
+			if values[keys[start+i]], err = counter(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return values, nil
 }
 
-// AddCountry will create country record in set of all countries.
-func (d Keeper) AddCountry(c string) error {
-	return d.sadd(countries, c)
+// hgetallScript returns contents of every hash in KEYS, so hashes are read within single round trip.
+const hgetallScript = `
+local result = {}
+for i, key in ipairs(KEYS) do
+	result[i] = redis.call('HGETALL', key)
+end
+return result
+`
+
+// GetCountryCandidates returns scores of candidates within every given country, keyed by country code.
+// Country without votes has no candidates. Hashes are read in batches, like counters in GetMany.
+func (d Keeper) GetCountryCandidates(codes []string) (map[string]map[string]int, error) {
+	matrix := make(map[string]map[string]int, len(codes))
+
+	for start := 0; start < len(codes); start += mgetBatch {
+		end := start + mgetBatch
+		if end > len(codes) {
+			end = len(codes)
+		}
+
+		keys := make([]interface{}, 0, end-start)
+		for _, c := range codes[start:end] {
+			keys = append(keys, d.key(countryCandsPrefix, c))
+		}
+
+		resps, err := util.LuaEval(d.pool, hgetallScript, len(keys), keys...).Array()
+		if err != nil {
+			return nil, err
+		}
+
+		for i, r := range resps {
+			fields, err := r.Map()
+			if err != nil {
+				return nil, err
+			}
+
+			scores := make(map[string]int, len(fields))
+			for name, v := range fields {
+				if scores[name], err = strconv.Atoi(v); err != nil {
+					return nil, err
+				}
+			}
+
+			matrix[codes[start+i]] = scores
+		}
+	}
+
+	return matrix, nil
 }
 
 // AddCandidate adds the one to current voting.
 func (d Keeper) AddCandidate(p string) error {
-	return d.sadd(parties, p)
+	return d.sadd(d.key(parties), p)
 }
 
 // RemoveCandidate deletes single candidate with specified name.
 func (d Keeper) RemoveCandidate(p string) error {
-	return d.srem(parties, p)
+	return d.srem(d.key(parties), p)
+}
+
+// IsCandidate checks if candidate with given name is registered for voting.
+func (d Keeper) IsCandidate(p string) (bool, error) {
+	n, err := d.pool.Cmd(redisSIsMember, d.key(parties), p).Int()
+	return n == 1, err
+}
+
+// AddInvalidVote increments counter of votes that were sent for unknown candidates.
+func (d Keeper) AddInvalidVote() error {
+	return d.incr(d.key(invalid))
+}
+
+// GetInvalidVotes returns number of votes that were sent for unknown candidates.
+func (d Keeper) GetInvalidVotes() (int, error) {
+	return d.get(d.key(invalid))
+}
+
+// AddAlias registers alternative name or short code for a candidate.
+func (d Keeper) AddAlias(alias, p string) error {
+	_, err := d.pool.Cmd(redisHSet, d.key(aliases), alias, p).Int()
+	return err
+}
+
+// RemoveAlias deletes single alias, candidate stays untouched.
+func (d Keeper) RemoveAlias(alias string) error {
+	_, err := d.pool.Cmd(redisHDel, d.key(aliases), alias).Int()
+	return err
+}
+
+// GetAliases returns all aliases mapped to candidate names.
+func (d Keeper) GetAliases() (map[string]string, error) {
+	return d.pool.Cmd(redisHGetAll, d.key(aliases)).Map()
 }
 
 // GetAllCandidates returns all candidates currently taking part in voting.
 func (d Keeper) GetAllCandidates() ([]string, error) {
-	return d.smembers(parties)
+	return d.smembers(d.key(parties))
 }
 
 // GetAllCountries returnes all countries that were participating during voting.
 func (d Keeper) GetAllCountries() ([]string, error) {
-	return d.smembers(countries)
+	return d.smembers(d.key(countries))
+}
+
+// GetAllOperators returns all mobile operators that voters are subscribed to.
+func (d Keeper) GetAllOperators() ([]string, error) {
+	return d.smembers(d.key(operators))
+}
+
+// GetAllTypes returns all types of numbers that votes were sent from.
+func (d Keeper) GetAllTypes() ([]string, error) {
+	return d.smembers(d.key(numTypes))
+}
+
+// key builds full key name within event namespace.
+func (d Keeper) key(parts ...string) string {
+	return eventKey(d.event, parts...)
+}
+
+func eventKey(event string, parts ...string) string {
+	return namespace + ":" + event + ":" + strings.Join(parts, ":")
+}
+
+// getPrefixed reads counters of given names within namespace of prefix, result is keyed by name.
+func (d Keeper) getPrefixed(prefix string, names []string) (map[string]int, error) {
+	keys := make([]string, len(names))
+	for i, n := range names {
+		keys[i] = d.key(prefix, n)
+	}
+
+	values, err := d.GetMany(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]int, len(names))
+	for i, n := range names {
+		scores[n] = values[keys[i]]
+	}
+
+	return scores, nil
+}
+
+// get returns counter value, counter that was never incremented is zero.
+func (d Keeper) get(key string) (int, error) {
+	return counter(d.pool.Cmd(redisGet, key))
+}
+
+// getStr returns string value, missing key is an empty string.
+func (d Keeper) getStr(key string) (string, error) {
+	resp := d.pool.Cmd(redisGet, key)
+	if resp.IsType(redis.Nil) {
+		return "", nil
+	}
+
+	return resp.Str()
+}
+
+func (d Keeper) incr(key string) error {
+	_, err := d.pool.Cmd(redisIncr, key).Int()
+	return err
 }
 
 func (d Keeper) sadd(set, name string) error {
@@ -75,8 +298,26 @@ func (d Keeper) srem(set, name string) error {
 	return err
 }
 
-// smembers WILL SLOWDOWN your SERVER if used with large sets.
+// smembers returns all members of the set. It iterates with SSCAN, so Redis is not blocked
+// while large set is being read. SSCAN can return the same member twice if set changes meanwhile, duplicates are skipped.
 func (d Keeper) smembers(set string) ([]string, error) {
-	response, err := d.pool.Cmd(redisSMembers, set).List()
-	return response, err
+	var (
+		members []string
+		seen    = make(map[string]bool)
+		ch      = make(chan string)
+		done    = make(chan error)
+	)
+
+	go func() {
+		done <- util.Scan(d.pool, ch, redisSScan, set, "*")
+	}()
+
+	for m := range ch {
+		if !seen[m] {
+			seen[m] = true
+			members = append(members, m)
+		}
+	}
+
+	return members, <-done
 }
@@ -0,0 +1,36 @@
+package score
+
+import (
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+)
+
+// lookupPrefix namespaces cached lookups of MSISDN. They do not depend on event, so they are outside of event namespace.
+const lookupPrefix = namespace + ":lookup:"
+
+// Lookups caches results of MSISDN lookups in Redis, so they are shared by all instances.
+type Lookups struct {
+	pool ConnectionPool
+}
+
+// NewLookups returns pointer to created Lookups instance initialized with Redis pool.
+func NewLookups(p ConnectionPool) *Lookups {
+	return &Lookups{pool: p}
+}
+
+// Get returns cached lookup of MSISDN. Returns false if it is not cached.
+func (l Lookups) Get(msisdn string) (string, bool, error) {
+	resp := l.pool.Cmd(redisGet, lookupPrefix+msisdn)
+	if resp.IsType(redis.Nil) {
+		return "", false, nil
+	}
+
+	data, err := resp.Str()
+	return data, err == nil, err
+}
+
+// Set caches lookup of MSISDN for given time, it is rounded down to seconds but not below one second.
+func (l Lookups) Set(msisdn, data string, ttl time.Duration) error {
+	return l.pool.Cmd(redisSet, lookupPrefix+msisdn, data, "EX", seconds(ttl)).Err
+}
@@ -0,0 +1,132 @@
+package score
+
+import (
+	"log"
+	"strings"
+
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Keys of the legacy schema. Counters of candidates and countries were top level keys named after them.
+const (
+	legacyCountries = "ALL_COUNTRIES"
+	legacyParties   = "ALL_PARTIES"
+	legacyInvalid   = "INVALID_VOTES"
+	legacyAliases   = "ALL_ALIASES"
+	legacyRejected  = "REJECTED_VOTES"
+	legacyVoter     = "VOTER:"
+	legacyLastVote  = "LAST_VOTE:"
+
+	redisExists   = "EXISTS"
+	redisRenameNX = "RENAMENX"
+	redisScan     = "SCAN"
+)
+
+// Migrate moves keys of the legacy schema into namespace of given event. Returns number of moved keys.
+// It is safe to run it again, keys that were moved already are skipped.
+func Migrate(p ConnectionPool, event string) (int, error) {
+	var moved int
+
+	move := func(from, to string) error {
+		ok, err := rename(p, from, to)
+		if ok {
+			moved++
+		}
+		return err
+	}
+
+	// Counters first, legacy sets are needed to find them.
+	candidates, err := p.Cmd(redisSMembers, legacyParties).List()
+	if err != nil {
+		return moved, err
+	}
+
+	cands := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		cands[c] = true
+		if err = move(c, eventKey(event, candPrefix, c)); err != nil {
+			return moved, err
+		}
+	}
+
+	countryCodes, err := p.Cmd(redisSMembers, legacyCountries).List()
+	if err != nil {
+		return moved, err
+	}
+
+	for _, c := range countryCodes {
+		if cands[c] {
+			// Both counters were the same key, votes can not be split anymore.
+			log.Printf("Key %q is both candidate and country, moved to candidate counter.", c)
+			continue
+		}
+		if err = move(c, eventKey(event, countryPrefix, c)); err != nil {
+			return moved, err
+		}
+	}
+
+	for from, to := range map[string]string{
+		legacyParties:   eventKey(event, parties),
+		legacyCountries: eventKey(event, countries),
+		legacyInvalid:   eventKey(event, invalid),
+		legacyAliases:   eventKey(event, aliases),
+		legacyRejected:  eventKey(event, rejected),
+	} {
+		if err = move(from, to); err != nil {
+			return moved, err
+		}
+	}
+
+	for prefix, to := range map[string]string{
+		legacyVoter:    voterPrefix,
+		legacyLastVote: lastVotePrefix,
+	} {
+		keys, err := scan(p, prefix+"*")
+		if err != nil {
+			return moved, err
+		}
+
+		for _, k := range keys {
+			if err = move(k, eventKey(event, to, strings.TrimPrefix(k, prefix))); err != nil {
+				return moved, err
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// rename moves key if it exists and new name is not taken yet.
+func rename(p ConnectionPool, from, to string) (bool, error) {
+	n, err := p.Cmd(redisExists, from).Int()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	n, err = p.Cmd(redisRenameNX, from, to).Int()
+	if err == nil && n == 0 {
+		log.Printf("Key %q was not moved, %q already exists.", from, to)
+	}
+
+	return n == 1, err
+}
+
+// scan collects all keys matching pattern. Keys are collected before any of them is renamed,
+// renaming while scanning could make SCAN return the same key twice.
+func scan(p ConnectionPool, pattern string) ([]string, error) {
+	var (
+		keys []string
+		ch   = make(chan string)
+		done = make(chan error)
+	)
+
+	go func() {
+		done <- util.Scan(p, ch, redisScan, "", pattern)
+	}()
+
+	for k := range ch {
+		keys = append(keys, k)
+	}
+
+	return keys, <-done
+}
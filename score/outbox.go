@@ -0,0 +1,201 @@
+package score
+
+import (
+	"time"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Outbound messages wait in pending list. Worker atomically moves message to processing list
+// and removes it from there once it is sent, so message that was being sent during crash is not lost.
+// Every message in processing list has a lease in leases hash, time in milliseconds until which it is being sent.
+// Message which lease expired is returned to pending list, worker that was sending it is considered dead.
+// Message that failed is moved from processing list either to retry set, scored by time in milliseconds
+// when it is due, or to dead letters hash by message ID.
+const (
+	outboxPending    = namespace + ":outbox"
+	outboxProcessing = namespace + ":outbox:processing"
+	outboxLeases     = namespace + ":outbox:leases"
+	outboxRetry      = namespace + ":outbox:retry"
+	outboxDead       = namespace + ":outbox:dead"
+)
+
+// leaseTTL is how long message can be sent before it is returned to the queue. It must be longer
+// than worker waits for rate limiter plus timeout of request to provider, otherwise message can be sent twice.
+const leaseTTL = 5 * time.Minute
+
+// promoteBatch is max number of due retries moved to pending list at once.
+const promoteBatch = 100
+
+const (
+	redisLPush      = "LPUSH"
+	redisLLen       = "LLEN"
+	redisBRPopLPush = "BRPOPLPUSH"
+)
+
+// promoteScript moves due retries to the end of pending list that is popped first.
+// KEYS: retry set, pending list. ARGV: current time in milliseconds, max number of messages.
+const promoteScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, m in ipairs(due) do
+	redis.call('ZREM', KEYS[1], m)
+	redis.call('RPUSH', KEYS[2], m)
+end
+return #due
+`
+
+// reclaimScript returns messages which lease expired to the end of pending list that is popped first.
+// Message without lease was just popped or its worker died before taking the lease, it gets a lease now,
+// so it is returned only if nobody takes it in time.
+// KEYS: processing list, leases hash, pending list. ARGV: current time in milliseconds, expiry of new lease.
+const reclaimScript = `
+local moved = 0
+for _, m in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	local lease = tonumber(redis.call('HGET', KEYS[2], m))
+	if not lease then
+		redis.call('HSET', KEYS[2], m, ARGV[2])
+	elseif lease <= tonumber(ARGV[1]) then
+		redis.call('LREM', KEYS[1], 1, m)
+		redis.call('HDEL', KEYS[2], m)
+		redis.call('RPUSH', KEYS[3], m)
+		moved = moved + 1
+	end
+end
+return moved
+`
+
+// ackScript removes processed message together with its lease.
+// KEYS: processing list, leases hash. ARGV: processed message.
+const ackScript = `
+redis.call('HDEL', KEYS[2], ARGV[1])
+return redis.call('LREM', KEYS[1], 1, ARGV[1])
+`
+
+// retryScript replaces processed message with its next attempt.
+// KEYS: processing list, leases hash, retry set. ARGV: processed message, next attempt, due time in milliseconds.
+const retryScript = `
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2])
+`
+
+// buryScript replaces processed message with dead letter.
+// KEYS: processing list, leases hash, dead letters hash. ARGV: processed message, message ID, dead letter.
+const buryScript = `
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return redis.call('HSET', KEYS[3], ARGV[2], ARGV[3])
+`
+
+// reviveScript queues message instead of dead letter if it still exists.
+// KEYS: dead letters hash, pending list. ARGV: message ID, message.
+const reviveScript = `
+if redis.call('HDEL', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('LPUSH', KEYS[2], ARGV[2])
+return 1
+`
+
+// Outbox is a durable queue of outbound messages backed by Redis lists. Messages are popped in order they were pushed.
+// Several instances can share the queue, message is sent by one of them.
+type Outbox struct {
+	pool  ConnectionPool
+	lease time.Duration
+}
+
+// NewOutbox returns pointer to created Outbox instance initialized with Redis pool.
+func NewOutbox(p ConnectionPool) *Outbox {
+	return &Outbox{pool: p, lease: leaseTTL}
+}
+
+// Push adds serialized message to the queue.
+func (o Outbox) Push(data string) error {
+	_, err := o.pool.Cmd(redisLPush, outboxPending, data).Int()
+	return err
+}
+
+// Pop takes the oldest message, waiting for it up to timeout. Returns empty string if queue stayed empty.
+// Retries that are due and messages which lease expired are popped before other messages.
+// Message stays in processing list until it is acknowledged or its lease expires.
+// Connection is held while waiting, so pool must be larger than number of workers.
+func (o Outbox) Pop(timeout time.Duration) (string, error) {
+	secs := int(timeout / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	if _, err := o.reclaim(); err != nil {
+		return "", err
+	}
+
+	if err := util.LuaEval(o.pool, promoteScript, 2, outboxRetry, outboxPending, millis(time.Now()), promoteBatch).Err; err != nil {
+		return "", err
+	}
+
+	resp := o.pool.Cmd(redisBRPopLPush, outboxPending, outboxProcessing, secs)
+	if resp.IsType(redis.Nil) {
+		return "", nil
+	}
+
+	data, err := resp.Str()
+	if err != nil {
+		return "", err
+	}
+
+	// Message without lease is not lost if this fails, reclaim gives it one.
+	if err = o.pool.Cmd(redisHSet, outboxLeases, data, millis(time.Now().Add(o.lease))).Err; err != nil {
+		return "", err
+	}
+
+	return data, nil
+}
+
+// Ack removes message that was handled from processing list.
+func (o Outbox) Ack(data string) error {
+	return util.LuaEval(o.pool, ackScript, 2, outboxProcessing, outboxLeases, data).Err
+}
+
+// Retry replaces processed message with its next attempt that is popped not earlier than given time.
+func (o Outbox) Retry(data, next string, at time.Time) error {
+	return util.LuaEval(o.pool, retryScript, 3, outboxProcessing, outboxLeases, outboxRetry, data, next, millis(at)).Err
+}
+
+// Bury replaces processed message with dead letter stored under message ID.
+func (o Outbox) Bury(data, id, letter string) error {
+	return util.LuaEval(o.pool, buryScript, 3, outboxProcessing, outboxLeases, outboxDead, data, id, letter).Err
+}
+
+// DeadLetters returns all dead letters by message ID.
+func (o Outbox) DeadLetters() (map[string]string, error) {
+	return o.pool.Cmd(redisHGetAll, outboxDead).Map()
+}
+
+// Revive removes dead letter and queues given message instead. Returns false if there is no such dead letter.
+func (o Outbox) Revive(id, data string) (bool, error) {
+	n, err := util.LuaEval(o.pool, reviveScript, 2, outboxDead, outboxPending, id, data).Int()
+	return n == 1, err
+}
+
+// Recover returns messages which lease expired to the queue, their workers died while sending them.
+// Messages that other instances are sending at the moment keep their leases, so they are not sent twice.
+// Pop does the same, Recover tells on startup how many messages were returned.
+func (o Outbox) Recover() (int, error) {
+	return o.reclaim()
+}
+
+func (o Outbox) reclaim() (int, error) {
+	now := time.Now()
+	return util.LuaEval(o.pool, reclaimScript, 3, outboxProcessing, outboxLeases, outboxPending, millis(now), millis(now.Add(o.lease))).Int()
+}
+
+// Len returns number of messages waiting to be sent.
+func (o Outbox) Len() (int, error) {
+	return o.pool.Cmd(redisLLen, outboxPending).Int()
+}
+
+// millis returns Unix time in milliseconds, it is used as score of retry set.
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
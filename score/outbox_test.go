@@ -0,0 +1,173 @@
+//go:build integration
+// +build integration
+
+package score
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxPopsInOrderOfPush(t *testing.T) {
+	o := NewOutbox(testPool(t))
+
+	for _, m := range []string{"first", "second"} {
+		if err := o.Push(m); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	for _, expected := range []string{"first", "second", ""} {
+		data, err := o.Pop(time.Second)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		if data != expected {
+			t.Errorf("Popped %q, expected %q", data, expected)
+		}
+
+		if data != "" {
+			if err = o.Ack(data); err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+		}
+	}
+
+	if n, _ := o.pool.Cmd(redisLLen, outboxProcessing).Int(); n != 0 {
+		t.Errorf("%d messages are still processing, expected none", n)
+	}
+
+	if n, _ := o.pool.Cmd("HLEN", outboxLeases).Int(); n != 0 {
+		t.Errorf("%d leases are left, expected none", n)
+	}
+}
+
+func TestOutboxRetryIsPoppedWhenDue(t *testing.T) {
+	o := NewOutbox(testPool(t))
+
+	if err := o.Push("attempt 1"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	data, _ := o.Pop(time.Second)
+	if err := o.Retry(data, "attempt 2", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if data, _ = o.Pop(time.Second); data != "" {
+		t.Errorf("Popped %q, expected retry to wait", data)
+	}
+
+	// Retry is due now.
+	if err := o.pool.Cmd("ZADD", outboxRetry, millis(time.Now().Add(-time.Second)), "attempt 2").Err; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err := o.Push("other"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if data, _ = o.Pop(time.Second); data != "attempt 2" {
+		t.Errorf("Popped %q, expected due retry before other messages", data)
+	}
+
+	if n, _ := o.pool.Cmd("LREM", outboxProcessing, 0, "attempt 1").Int(); n != 0 {
+		t.Error("Retried message is still processing.")
+	}
+}
+
+func TestOutboxBuryAndRevive(t *testing.T) {
+	o := NewOutbox(testPool(t))
+
+	if err := o.Push("message"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	data, _ := o.Pop(time.Second)
+	if err := o.Bury(data, "id1", "letter"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	letters, err := o.DeadLetters()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if len(letters) != 1 || letters["id1"] != "letter" {
+		t.Errorf("Dead letters: %v, expected letter of id1", letters)
+	}
+
+	if ok, err := o.Revive("id2", "message"); ok || err != nil {
+		t.Errorf("Revived unknown letter: %t, error: %v", ok, err)
+	}
+
+	if ok, err := o.Revive("id1", "message again"); !ok || err != nil {
+		t.Errorf("Revived letter: %t, error: %v, expected it to be queued", ok, err)
+	}
+
+	if data, _ = o.Pop(time.Second); data != "message again" {
+		t.Errorf("Popped %q, expected revived message", data)
+	}
+
+	if letters, _ = o.DeadLetters(); len(letters) != 0 {
+		t.Errorf("Dead letters: %v, expected none", letters)
+	}
+}
+
+func TestOutboxReturnsOnlyExpiredLeases(t *testing.T) {
+	p := testPool(t)
+
+	// Two instances share the queue, the first one dies while sending.
+	dead, alive := NewOutbox(p), NewOutbox(p)
+
+	for _, m := range []string{"lost", "sending"} {
+		if err := dead.Push(m); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	lost, _ := dead.Pop(time.Second)
+	sending, _ := alive.Pop(time.Second)
+
+	if n, err := alive.Recover(); n != 0 || err != nil {
+		t.Errorf("Recovered %d messages, error: %v, expected none while leases are valid", n, err)
+	}
+
+	// Lease of the dead instance expires.
+	if err := p.Cmd(redisHSet, outboxLeases, lost, millis(time.Now().Add(-time.Second))).Err; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if n, err := alive.Recover(); n != 1 || err != nil {
+		t.Errorf("Recovered %d messages, error: %v, expected 1", n, err)
+	}
+
+	if data, _ := alive.Pop(time.Second); data != lost {
+		t.Errorf("Popped %q, expected %q", data, lost)
+	}
+
+	if err := alive.Ack(sending); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+}
+
+func TestOutboxLeasesMessageThatHasNone(t *testing.T) {
+	o := NewOutbox(testPool(t))
+	o.lease = time.Millisecond
+
+	// Worker died right after message was moved to processing list.
+	if err := o.pool.Cmd(redisLPush, outboxProcessing, "orphan").Err; err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if n, err := o.Recover(); n != 0 || err != nil {
+		t.Errorf("Recovered %d messages, error: %v, expected message to get a lease first", n, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if n, err := o.Recover(); n != 1 || err != nil {
+		t.Errorf("Recovered %d messages, error: %v, expected 1 once lease expired", n, err)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build integration
+// +build integration
+
+package score
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mediocregopher/radix.v2/pool"
+)
+
+// testEvent is the event that keys of tests are namespaced by.
+const testEvent = "test"
+
+// testPool connects to Redis given by REDIS_TEST_ADDR. Database is flushed before every test,
+// so it must be a disposable server that nothing else uses. Tests are skipped if address is not set.
+func testPool(t *testing.T) *pool.Pool {
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR is not set, Redis tests skipped.")
+	}
+
+	p, err := pool.New("tcp", addr, 2)
+	if err != nil {
+		t.Fatal("Failed to connect to Redis, error:", err)
+	}
+
+	if err = p.Cmd("FLUSHDB").Err; err != nil {
+		t.Fatal("Failed to flush Redis, error:", err)
+	}
+
+	return p
+}
+
+// openKeeper returns Keeper of the test event that accepts votes.
+func openKeeper(t *testing.T) *Keeper {
+	k := NewKeeper(testPool(t), testEvent)
+	if err := k.SetState(openState); err != nil {
+		t.Fatal("Failed to open event, error:", err)
+	}
+
+	return k
+}
+
+// counters reads values of given keys within test event, missing key is zero.
+func counters(t *testing.T, k *Keeper, keys ...string) []int {
+	values := make([]int, len(keys))
+	for i, key := range keys {
+		v, err := k.get(k.key(key))
+		if err != nil {
+			t.Fatalf("Failed to read %q, error: %v", key, err)
+		}
+		values[i] = v
+	}
+
+	return values
+}
@@ -0,0 +1,54 @@
+package score
+
+// Keys that hold event lifecycle: current state, results frozen at closing and counters of votes outside of voting window.
+const (
+	state   = "state"
+	results = "results"
+	early   = "early"
+	late    = "late"
+
+	// openState is the state of event that accepts votes, votes are recorded only while event is in it.
+	openState = "open"
+
+	redisSet = "SET"
+)
+
+// GetState returns current lifecycle state of the event, empty string if it was never set.
+func (d Keeper) GetState() (string, error) {
+	return d.getStr(d.key(state))
+}
+
+// SetState stores lifecycle state of the event.
+func (d Keeper) SetState(s string) error {
+	return d.pool.Cmd(redisSet, d.key(state), s).Err
+}
+
+// FreezeResults stores serialized results of the event at the moment of closing.
+func (d Keeper) FreezeResults(data string) error {
+	return d.pool.Cmd(redisSet, d.key(results), data).Err
+}
+
+// GetFrozenResults returns serialized results of closed event, empty string if they were not frozen.
+func (d Keeper) GetFrozenResults() (string, error) {
+	return d.getStr(d.key(results))
+}
+
+// AddEarlyVote increments counter of votes that came before event was opened.
+func (d Keeper) AddEarlyVote() error {
+	return d.incr(d.key(early))
+}
+
+// GetEarlyVotes returns number of votes that came before event was opened.
+func (d Keeper) GetEarlyVotes() (int, error) {
+	return d.get(d.key(early))
+}
+
+// AddLateVote increments counter of votes that came after event was closed.
+func (d Keeper) AddLateVote() error {
+	return d.incr(d.key(late))
+}
+
+// GetLateVotes returns number of votes that came after event was closed.
+func (d Keeper) GetLateVotes() (int, error) {
+	return d.get(d.key(late))
+}
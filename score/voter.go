@@ -0,0 +1,289 @@
+package score
+
+import (
+	"errors"
+
+	"github.com/mediocregopher/radix.v2/redis"
+	"github.com/mediocregopher/radix.v2/util"
+)
+
+// Every voter has a hash with total number of accepted votes and number of votes per candidate.
+// Last vote of the voter is stored separately, it is needed when every new vote replaces previous one.
+const (
+	voterPrefix     = "voter"
+	lastVotePrefix  = "last"
+	totalField      = "total"
+	candFieldPrefix = "cand:"
+	ballots         = "ballots"
+)
+
+// Outcomes of recording a vote.
+const (
+	VoteRecorded = "recorded"
+	VoteRejected = "rejected" // Voter exceeded the limit, nothing was changed.
+	VoteClosed   = "closed"   // Event is not open anymore, nothing was changed.
+)
+
+// Vote is a single vote together with the limits of the voter it must fit in. Zero limit means no limit.
+type Vote struct {
+	Candidate    string
+	Country      string
+	Operator     string
+	Type         string // Type of number: mobile, fixed, voip or other.
+	MSISDN       string
+	Ballot       string // All preferences of the voter, stored as is.
+	PerVoter     int    // Max votes of the voter in total.
+	PerCandidate int    // Max votes of the voter for the same candidate.
+}
+
+// voteChanged is returned by the script when last vote of the voter changed after it was read, nothing was changed then.
+const voteChanged = "changed"
+
+// maxVoteAttempts limits how many times replacing vote is retried when last vote changes meanwhile.
+const maxVoteAttempts = 3
+
+// ErrVoteConflict is returned when vote could not replace previous one, because voter kept changing it meanwhile.
+var ErrVoteConflict = errors.New("last vote changed while it was replaced")
+
+// recordVoteScript applies all counter and set updates of a single vote at once.
+// Redis runs scripts atomically, so candidate, country, operator and number type totals always reconcile,
+// as well as scores of candidates within each country. Limits of the voter are checked within the script too,
+// so parallel messages from the same MSISDN can not pass the check together.
+// State of the event is checked last time as well, so vote can not be counted after event is closed and results are frozen.
+//
+// KEYS: candidate counter, set of countries, country counter, voter hash, voter's last vote hash,
+// set of operators, operator counter, set of number types, number type counter, hash of candidate scores within country,
+// hash of ballots, state of the event. If vote replaces previous one, counters of the previous vote follow:
+// candidate, country, hash of candidate scores within country, operator and number type.
+// ARGV: country code, candidate name, operator, number type, ballot, MSISDN, voter hash field of candidate,
+// max votes of the voter in total and for the candidate, 0 for no limit, state of the event that accepts votes,
+// "1" if vote replaces previous one, candidate, country, operator and number type of the previous vote as it was read
+// before the script, voter hash field of the previous candidate.
+// Every key is passed in KEYS, so previous vote is read beforehand. If it changed meanwhile, nothing is changed
+// and the vote has to be recorded again with fresh keys.
+// Replaced vote is retracted from voter's counters as well, so it does not count against the limits.
+// Ballot replaces previous ballot of the voter if vote is replaced, otherwise it is added under MSISDN and number of the vote.
+//
+// Returns outcome and candidate of the replaced vote or empty string.
+const recordVoteScript = `
+if redis.call('GET', KEYS[12]) ~= ARGV[10] then
+	return {'` + VoteClosed + `', ''}
+end
+
+local replace = ARGV[11] == '1'
+
+if replace then
+	local prev = redis.call('HMGET', KEYS[5], 'candidate', 'country', 'operator', 'type')
+	for i = 1, 4 do
+		if (prev[i] or '') ~= ARGV[11 + i] then
+			return {'` + voteChanged + `', ''}
+		end
+	end
+end
+
+local replacing = replace and ARGV[12] ~= ''
+
+local voted = redis.call('HMGET', KEYS[4], 'total', ARGV[7])
+local total, forCand = tonumber(voted[1]) or 0, tonumber(voted[2]) or 0
+local perVoter, perCand = tonumber(ARGV[8]), tonumber(ARGV[9])
+
+if replacing and ARGV[12] == ARGV[2] then
+	forCand = forCand - 1
+end
+
+if not replacing and perVoter > 0 and total >= perVoter or perCand > 0 and forCand >= perCand then
+	return {'` + VoteRejected + `', ''}
+end
+
+if replacing then
+	redis.call('DECR', KEYS[13])
+	redis.call('DECR', KEYS[14])
+	redis.call('HINCRBY', KEYS[15], ARGV[12], -1)
+	redis.call('DECR', KEYS[16])
+	redis.call('DECR', KEYS[17])
+	redis.call('HINCRBY', KEYS[4], ARGV[16], -1)
+end
+
+redis.call('INCR', KEYS[1])
+redis.call('SADD', KEYS[2], ARGV[1])
+redis.call('INCR', KEYS[3])
+redis.call('HINCRBY', KEYS[10], ARGV[2], 1)
+redis.call('SADD', KEYS[6], ARGV[3])
+redis.call('INCR', KEYS[7])
+redis.call('SADD', KEYS[8], ARGV[4])
+redis.call('INCR', KEYS[9])
+if not replacing then
+	total = redis.call('HINCRBY', KEYS[4], 'total', 1)
+end
+redis.call('HINCRBY', KEYS[4], ARGV[7], 1)
+
+if replace then
+	redis.call('HSET', KEYS[11], ARGV[6], ARGV[5])
+else
+	redis.call('HSET', KEYS[11], ARGV[6] .. ':' .. total, ARGV[5])
+end
+
+redis.call('HMSET', KEYS[5], 'candidate', ARGV[2], 'country', ARGV[1], 'operator', ARGV[3], 'type', ARGV[4])
+
+if replacing then
+	return {'` + VoteRecorded + `', ARGV[12]}
+end
+
+return {'` + VoteRecorded + `', ''}
+`
+
+// RecordVote atomically checks limits of the voter, adds a point to candidate, country, candidate within country,
+// operator and type of number, stores ballot and updates counters of the voter.
+// Returns VoteRejected if voter exceeded one of the limits and VoteClosed if event is not open.
+func (d Keeper) RecordVote(v Vote) (string, error) {
+	outcome, _, err := d.recordVote(v, nil)
+	return outcome, err
+}
+
+// ReplaceVote atomically records the vote and retracts previous vote of the same voter.
+// Replaced vote does not count against the limits.
+// Returns outcome and candidate that previous vote was given to or empty string if this is the first vote.
+func (d Keeper) ReplaceVote(v Vote) (string, string, error) {
+	for i := 0; i < maxVoteAttempts; i++ {
+		prev, err := d.lastVote(v.MSISDN)
+		if err != nil {
+			return "", "", err
+		}
+
+		outcome, replaced, err := d.recordVote(v, prev)
+		if err != nil || outcome != voteChanged {
+			return outcome, replaced, err
+		}
+	}
+
+	return "", "", ErrVoteConflict
+}
+
+// lastVote reads candidate, country, operator and type of the last vote of the voter.
+// Fields are empty if voter has not voted yet.
+func (d Keeper) lastVote(msisdn string) ([]string, error) {
+	resps, err := d.pool.Cmd(redisHMGet, d.key(lastVotePrefix, msisdn), "candidate", "country", "operator", "type").Array()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, len(resps))
+	for i, r := range resps {
+		if r.IsType(redis.Nil) {
+			continue
+		}
+
+		if fields[i], err = r.Str(); err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+// recordVote runs the script. Previous vote is given only if vote replaces it, fields are empty if there is none.
+func (d Keeper) recordVote(v Vote, prev []string) (string, string, error) {
+	keys := []interface{}{
+		d.key(candPrefix, v.Candidate),
+		d.key(countries),
+		d.key(countryPrefix, v.Country),
+		d.key(voterPrefix, v.MSISDN),
+		d.key(lastVotePrefix, v.MSISDN),
+		d.key(operators),
+		d.key(opPrefix, v.Operator),
+		d.key(numTypes),
+		d.key(typePrefix, v.Type),
+		d.key(countryCandsPrefix, v.Country),
+		d.key(ballots),
+		d.key(state),
+	}
+
+	args := []interface{}{
+		v.Country,
+		v.Candidate,
+		v.Operator,
+		v.Type,
+		v.Ballot,
+		v.MSISDN,
+		candFieldPrefix + v.Candidate,
+		v.PerVoter,
+		v.PerCandidate,
+		openState,
+	}
+
+	if prev != nil {
+		cand, country, operator, numType := prev[0], prev[1], prev[2], prev[3]
+		if cand != "" {
+			keys = append(keys,
+				d.key(candPrefix, cand),
+				d.key(countryPrefix, country),
+				d.key(countryCandsPrefix, country),
+				d.key(opPrefix, operator),
+				d.key(typePrefix, numType),
+			)
+		}
+		args = append(args, "1", cand, country, operator, numType, candFieldPrefix+cand)
+	}
+
+	resp, err := util.LuaEval(d.pool, recordVoteScript, len(keys), append(keys, args...)...).List()
+	if err != nil {
+		return "", "", err
+	}
+
+	return resp[0], resp[1], nil
+}
+
+// GetBallots returns all stored ballots. Hash is iterated with HSCAN, so Redis is not blocked by large event.
+func (d Keeper) GetBallots() ([]string, error) {
+	var (
+		fields = make(map[string]string)
+		ch     = make(chan string)
+		done   = make(chan error)
+	)
+
+	go func() {
+		done <- util.Scan(d.pool, ch, redisHScan, d.key(ballots), "*")
+	}()
+
+	// HSCAN returns field followed by its value. The same field can come twice if hash changes meanwhile.
+	var field string
+	odd := false
+	for s := range ch {
+		if odd {
+			fields[field] = s
+		} else {
+			field = s
+		}
+		odd = !odd
+	}
+
+	if err := <-done; err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(fields))
+	for _, b := range fields {
+		list = append(list, b)
+	}
+
+	return list, nil
+}
+
+// AddRejectedVote increments counter of votes rejected because voter exceeded the limit.
+func (d Keeper) AddRejectedVote() error {
+	return d.incr(d.key(rejected))
+}
+
+// GetRejectedVotes returns number of votes rejected because voters exceeded the limit.
+func (d Keeper) GetRejectedVotes() (int, error) {
+	return d.get(d.key(rejected))
+}
+
+// counter reads integer reply, missing value is treated as zero.
+func counter(r *redis.Resp) (int, error) {
+	if r.IsType(redis.Nil) {
+		return 0, nil
+	}
+
+	return r.Int()
+}
@@ -0,0 +1,199 @@
+//go:build integration
+// +build integration
+
+package score
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRecordVoteCountsEverything(t *testing.T) {
+	k := openKeeper(t)
+
+	votes := []Vote{
+		{Candidate: "ABBA", Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000001", Ballot: `["ABBA"]`},
+		{Candidate: "Lordi", Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000002", Ballot: `["Lordi","ABBA"]`},
+		{Candidate: "ABBA", Country: "UA", Operator: "Kyivstar", Type: "fixed", MSISDN: "380440000001", Ballot: `["ABBA"]`},
+	}
+
+	for _, v := range votes {
+		outcome, err := k.RecordVote(v)
+		if err != nil || outcome != VoteRecorded {
+			t.Fatalf("Outcome: %q, error: %v, expected %q", outcome, err, VoteRecorded)
+		}
+	}
+
+	got := counters(t, k, "cand:ABBA", "cand:Lordi", "country:NL", "country:UA", "operator:KPN", "operator:Kyivstar", "type:mobile", "type:fixed")
+	if expected := []int{2, 1, 2, 1, 2, 1, 2, 1}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Counters: %v, expected %v", got, expected)
+	}
+
+	matrix, err := k.GetCountryCandidates([]string{"NL", "UA"})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := map[string]map[string]int{"NL": {"ABBA": 1, "Lordi": 1}, "UA": {"ABBA": 1}}
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Errorf("Candidates within countries: %v, expected %v", matrix, expected)
+	}
+
+	ballots, err := k.GetBallots()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	sort.Strings(ballots)
+	if expected := []string{`["ABBA"]`, `["ABBA"]`, `["Lordi","ABBA"]`}; !reflect.DeepEqual(ballots, expected) {
+		t.Errorf("Ballots: %v, expected %v", ballots, expected)
+	}
+
+	for set, expected := range map[string][]string{countries: {"NL", "UA"}, operators: {"KPN", "Kyivstar"}, numTypes: {"fixed", "mobile"}} {
+		members, err := k.smembers(k.key(set))
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		sort.Strings(members)
+		if !reflect.DeepEqual(members, expected) {
+			t.Errorf("Set %q: %v, expected %v", set, members, expected)
+		}
+	}
+}
+
+func TestRecordVoteChecksLimits(t *testing.T) {
+	k := openKeeper(t)
+
+	vote := func(cand string) Vote {
+		return Vote{Candidate: cand, Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000001", Ballot: `["` + cand + `"]`, PerVoter: 2, PerCandidate: 1}
+	}
+
+	cases := []struct {
+		cand    string
+		outcome string
+	}{
+		{"ABBA", VoteRecorded},
+		{"ABBA", VoteRejected},
+		{"Lordi", VoteRecorded},
+		{"Loreen", VoteRejected},
+	}
+
+	for i, c := range cases {
+		outcome, err := k.RecordVote(vote(c.cand))
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		if outcome != c.outcome {
+			t.Errorf("Vote #%d for %q: %q, expected %q", i+1, c.cand, outcome, c.outcome)
+		}
+	}
+
+	// Rejected votes change nothing.
+	got := counters(t, k, "cand:ABBA", "cand:Lordi", "cand:Loreen", "country:NL")
+	if expected := []int{1, 1, 0, 2}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Counters: %v, expected %v", got, expected)
+	}
+
+	if ballots, _ := k.GetBallots(); len(ballots) != 2 {
+		t.Errorf("Ballots: %v, expected 2 of them", ballots)
+	}
+}
+
+func TestRecordVoteRefusedIfEventIsNotOpen(t *testing.T) {
+	k := openKeeper(t)
+
+	if err := k.SetState("closed"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	v := Vote{Candidate: "ABBA", Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000001", Ballot: `["ABBA"]`}
+
+	outcome, err := k.RecordVote(v)
+	if err != nil || outcome != VoteClosed {
+		t.Errorf("Outcome: %q, error: %v, expected %q", outcome, err, VoteClosed)
+	}
+
+	outcome, _, err = k.ReplaceVote(v)
+	if err != nil || outcome != VoteClosed {
+		t.Errorf("Outcome of replacing: %q, error: %v, expected %q", outcome, err, VoteClosed)
+	}
+
+	if got := counters(t, k, "cand:ABBA", "country:NL"); !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Errorf("Counters: %v, expected nothing counted", got)
+	}
+}
+
+func TestReplaceVoteRetractsPreviousVote(t *testing.T) {
+	k := openKeeper(t)
+
+	votes := []struct {
+		vote     Vote
+		replaced string
+	}{
+		{Vote{Candidate: "ABBA", Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000001", Ballot: `["ABBA"]`, PerCandidate: 1}, ""},
+		// Voter roamed to another country, the previous vote is retracted where it was counted.
+		{Vote{Candidate: "Lordi", Country: "UA", Operator: "Kyivstar", Type: "fixed", MSISDN: "31600000001", Ballot: `["Lordi"]`, PerCandidate: 1}, "ABBA"},
+		// Vote for the same candidate replaces itself, so it does not exceed the limit.
+		{Vote{Candidate: "Lordi", Country: "UA", Operator: "Kyivstar", Type: "fixed", MSISDN: "31600000001", Ballot: `["Lordi","ABBA"]`, PerCandidate: 1}, "Lordi"},
+	}
+
+	for i, c := range votes {
+		outcome, replaced, err := k.ReplaceVote(c.vote)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		if outcome != VoteRecorded || replaced != c.replaced {
+			t.Errorf("Vote #%d: %q replaced %q, expected %q replaced %q", i+1, outcome, replaced, VoteRecorded, c.replaced)
+		}
+	}
+
+	got := counters(t, k, "cand:ABBA", "cand:Lordi", "country:NL", "country:UA", "operator:KPN", "operator:Kyivstar", "type:mobile", "type:fixed")
+	if expected := []int{0, 1, 0, 1, 0, 1, 0, 1}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Counters: %v, expected %v", got, expected)
+	}
+
+	matrix, err := k.GetCountryCandidates([]string{"NL", "UA"})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := map[string]map[string]int{"NL": {"ABBA": 0}, "UA": {"Lordi": 1}}
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Errorf("Candidates within countries: %v, expected %v", matrix, expected)
+	}
+
+	ballots, err := k.GetBallots()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if expected := []string{`["Lordi","ABBA"]`}; !reflect.DeepEqual(ballots, expected) {
+		t.Errorf("Ballots: %v, expected %v", ballots, expected)
+	}
+}
+
+func TestReplaceVoteChecksLastVoteWasNotChanged(t *testing.T) {
+	k := openKeeper(t)
+
+	first := Vote{Candidate: "ABBA", Country: "NL", Operator: "KPN", Type: "mobile", MSISDN: "31600000001", Ballot: `["ABBA"]`}
+	if _, _, err := k.ReplaceVote(first); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	// Another vote of the same voter was recorded after this one read the last vote.
+	second := first
+	second.Candidate, second.Ballot = "Lordi", `["Lordi"]`
+
+	outcome, _, err := k.recordVote(second, []string{"", "", "", ""})
+	if err != nil || outcome != voteChanged {
+		t.Errorf("Outcome: %q, error: %v, expected %q", outcome, err, voteChanged)
+	}
+
+	if got := counters(t, k, "cand:ABBA", "cand:Lordi"); !reflect.DeepEqual(got, []int{1, 0}) {
+		t.Errorf("Counters: %v, expected stale vote to change nothing", got)
+	}
+}
@@ -1,9 +1,43 @@
 #!/bin/sh
 
 /opt/gokiezen/gokiezen \
-	--port $PORT \
-	--token $TOKEN \
-	--redis_host $REDIS_HOST \
-	--redis_port $REDIS_PORT \
-	--redis_pool_size $REDIS_POOL_SIZE \
-	--redis_conn_type $REDIS_CONNECTION_TYPE	
+	--port="$PORT" \
+	--event="$EVENT" \
+	--provider="$PROVIDER" \
+	--token="$TOKEN" \
+	--account="$ACCOUNT" \
+	--send_url="$SEND_URL" \
+	--send_template="$SEND_TEMPLATE" \
+	--api_keys="$API_KEYS" \
+	--signing_key="$SIGNING_KEY" \
+	--public_url="$PUBLIC_URL" \
+	--signature_window="$SIGNATURE_WINDOW" \
+	--insecure_webhook="$INSECURE_WEBHOOK" \
+	--dedup_ttl="$DEDUP_TTL" \
+	--sms_status_ttl="$SMS_STATUS_TTL" \
+	--lookup="$LOOKUP" \
+	--lookup_details="$LOOKUP_DETAILS" \
+	--numplan_prefixes="$NUMPLAN_PREFIXES" \
+	--lookup_cache_size="$LOOKUP_CACHE_SIZE" \
+	--lookup_ttl="$LOOKUP_TTL" \
+	--lookup_negative_ttl="$LOOKUP_NEGATIVE_TTL" \
+	--sms_rate="$SMS_RATE" \
+	--sms_burst="$SMS_BURST" \
+	--sms_workers="$SMS_WORKERS" \
+	--sms_attempts="$SMS_ATTEMPTS" \
+	--sms_retry_base="$SMS_RETRY_BASE" \
+	--sms_retry_max="$SMS_RETRY_MAX" \
+	--redis_host="$REDIS_HOST" \
+	--redis_port="$REDIS_PORT" \
+	--redis_pool_size="$REDIS_POOL_SIZE" \
+	--redis_conn_type="$REDIS_CONNECTION_TYPE" \
+	--match_distance="$MATCH_DISTANCE" \
+	--votes_per_voter="$VOTES_PER_VOTER" \
+	--votes_per_candidate="$VOTES_PER_CANDIDATE" \
+	--last_vote_wins="$LAST_VOTE_WINS" \
+	--opens_at="$OPENS_AT" \
+	--closes_at="$CLOSES_AT" \
+	--points="$POINTS" \
+	--exclude_self_votes="$EXCLUDE_SELF_VOTES" \
+	--candidate_countries="$CANDIDATE_COUNTRIES" \
+	--jury="$JURY"
@@ -0,0 +1,174 @@
+package voting
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Role defines what API key holder is allowed to do.
+type Role string
+
+// Viewer can only read, admin can also change candidates and events.
+const (
+	RoleViewer Role = "viewer"
+	RoleAdmin  Role = "admin"
+)
+
+// auditBodyLimit is a max number of request body bytes written to audit log.
+const auditBodyLimit = 256
+
+// ErrInvalidKeys is returned when API keys configuration can not be parsed.
+var ErrInvalidKeys = errors.New("invalid API keys configuration")
+
+// Credential describes holder of API key.
+type Credential struct {
+	Name string // Shown in audit log.
+	Role Role
+}
+
+// Auth checks API keys of requests to protected endpoints.
+// Key is accepted in "Authorization: Bearer <key>" or "X-API-Key: <key>" header.
+type Auth struct {
+	keys map[string]Credential
+}
+
+// NewAuth creates Auth that accepts given keys. Without keys every request to protected endpoint is rejected.
+func NewAuth(keys map[string]Credential) *Auth {
+	return &Auth{keys: keys}
+}
+
+// ParseKeys parses comma separated list of keys in "name:role:key" format.
+func ParseKeys(spec string) (map[string]Credential, error) {
+	keys := make(map[string]Credential)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, ErrInvalidKeys
+		}
+
+		role := Role(parts[1])
+		if role != RoleViewer && role != RoleAdmin {
+			return nil, ErrInvalidKeys
+		}
+
+		if _, ok := keys[parts[2]]; ok {
+			return nil, ErrInvalidKeys
+		}
+
+		keys[parts[2]] = Credential{Name: parts[0], Role: role}
+	}
+
+	return keys, nil
+}
+
+// Protect allows reading to viewers and admins, any other method is allowed to admins only.
+// Request without valid key is rejected with 401, request of viewer that tries to change something with 403.
+// Every change made by admin is written to audit log.
+func (a *Auth) Protect(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cred, ok := a.authenticate(req)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gokiezen"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			h(w, req)
+			return
+		}
+
+		if cred.Role != RoleAdmin {
+			log.Printf("Audit: %q (%s) is not allowed to %s %s", cred.Name, cred.Role, req.Method, req.URL.RequestURI())
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body := auditBody(req)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h(rec, req)
+
+		log.Printf("Audit: %q %s %s %q, status: %d", cred.Name, req.Method, req.URL.RequestURI(), body, rec.status)
+	}
+}
+
+// ProtectChanges allows reading to anyone, any other method is protected the same way as by Protect.
+// Stats and results are public like those of default event: they are shown to the audience,
+// and browser can not send API key with WebSocket handshake.
+func (a *Auth) ProtectChanges(h http.HandlerFunc) http.HandlerFunc {
+	protected := a.Protect(h)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			h(w, req)
+			return
+		}
+
+		protected(w, req)
+	}
+}
+
+// authenticate finds credential of the key that came with request.
+// Every configured key is compared in constant time, so response time does not leak the key.
+func (a *Auth) authenticate(req *http.Request) (Credential, bool) {
+	key := req.Header.Get("X-API-Key")
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	if key == "" {
+		return Credential{}, false
+	}
+
+	var (
+		found Credential
+		ok    bool
+	)
+
+	for k, cred := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found, ok = cred, true
+		}
+	}
+
+	return found, ok
+}
+
+// auditBody returns beginning of the request body. Body is restored, so handler can read it.
+func auditBody(req *http.Request) string {
+	if req.Body == nil {
+		return ""
+	}
+
+	head, err := io.ReadAll(io.LimitReader(req.Body, auditBodyLimit))
+	if err != nil {
+		log.Println("Failed to read request body for audit, error:", err)
+	}
+
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(head), req.Body))
+
+	return string(head)
+}
+
+// statusRecorder remembers response status for audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
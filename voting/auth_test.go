@@ -0,0 +1,134 @@
+package voting
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("alice:admin:s3cret, dash:viewer:pub1ic")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if keys["s3cret"] != (Credential{Name: "alice", Role: RoleAdmin}) {
+		t.Errorf("Credential of admin key: %+v", keys["s3cret"])
+	}
+
+	if keys["pub1ic"] != (Credential{Name: "dash", Role: RoleViewer}) {
+		t.Errorf("Credential of viewer key: %+v", keys["pub1ic"])
+	}
+
+	for _, spec := range []string{"alice:root:s3cret", "alice:admin", "alice:admin:k,bob:viewer:k"} {
+		if _, err = ParseKeys(spec); err != ErrInvalidKeys {
+			t.Errorf("Keys %q parsed with error: %v, expected %v", spec, err, ErrInvalidKeys)
+		}
+	}
+}
+
+func TestProtect(t *testing.T) {
+	auth := NewAuth(map[string]Credential{
+		"s3cret": {Name: "alice", Role: RoleAdmin},
+		"pub1ic": {Name: "dash", Role: RoleViewer},
+	})
+
+	var body string
+
+	h := auth.Protect(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	cases := []struct {
+		method   string
+		header   string
+		value    string
+		expected int
+	}{
+		{http.MethodPost, "", "", http.StatusUnauthorized},
+		{http.MethodGet, "Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "X-API-Key", "pub1ic", http.StatusCreated},
+		{http.MethodPost, "X-API-Key", "pub1ic", http.StatusForbidden},
+		{http.MethodDelete, "Authorization", "Bearer pub1ic", http.StatusForbidden},
+		{http.MethodPost, "Authorization", "Bearer s3cret", http.StatusCreated},
+	}
+
+	for _, c := range cases {
+		body = ""
+
+		req := httptest.NewRequest(c.method, "/candidates", strings.NewReader("ABBA"))
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if rec.Code != c.expected {
+			t.Errorf("%s with %s %q: status %d, expected %d", c.method, c.header, c.value, rec.Code, c.expected)
+		}
+
+		if c.expected == http.StatusCreated && body != "ABBA" {
+			t.Errorf("Handler got body %q, expected %q", body, "ABBA")
+		}
+	}
+}
+
+func TestProtectChangesLetsAnyoneRead(t *testing.T) {
+	auth := NewAuth(map[string]Credential{
+		"s3cret": {Name: "alice", Role: RoleAdmin},
+		"pub1ic": {Name: "dash", Role: RoleViewer},
+	})
+
+	h := auth.ProtectChanges(func(w http.ResponseWriter, req *http.Request) {})
+
+	cases := []struct {
+		method   string
+		key      string
+		expected int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodHead, "wrong", http.StatusOK},
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "pub1ic", http.StatusForbidden},
+		{http.MethodPost, "s3cret", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/events/eurovision/stats", nil)
+		if c.key != "" {
+			req.Header.Set("X-API-Key", c.key)
+		}
+
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if rec.Code != c.expected {
+			t.Errorf("%s with key %q: status %d, expected %d", c.method, c.key, rec.Code, c.expected)
+		}
+	}
+}
+
+func TestProtectAuditsQuery(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	auth := NewAuth(map[string]Credential{"s3cret": {Name: "alice", Role: RoleAdmin}})
+	h := auth.Protect(func(w http.ResponseWriter, req *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodDelete, "/candidates?name=ABBA", nil)
+	req.Header.Set("X-API-Key", "s3cret")
+	h(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), "DELETE /candidates?name=ABBA") {
+		t.Errorf("Audit log %q does not tell what was deleted", buf.String())
+	}
+}
@@ -0,0 +1,160 @@
+package voting
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ballotSeparators split SMS body into preferences: "ABBA, Lordi, Loreen".
+const ballotSeparators = ",;\n"
+
+// Ballot holds candidates in order of voter's preference, the first choice goes first.
+type Ballot []string
+
+// splitBallot splits text of the message into preferences, blank ones are skipped.
+func splitBallot(text string) []string {
+	var prefs []string
+
+	for _, p := range strings.FieldsFunc(text, func(r rune) bool { return strings.ContainsRune(ballotSeparators, r) }) {
+		if p = strings.TrimSpace(p); p != "" {
+			prefs = append(prefs, p)
+		}
+	}
+
+	return prefs
+}
+
+// resolveBallot finds registered candidates that SMS text refers to, in order of preference.
+// Message with single name is a ballot with single preference. Otherwise candidates and aliases are read once
+// and every preference is matched against them. If some of preferences can not be resolved, whole ballot
+// is not counted and voter gets single reply that lists all of them.
+// Candidate named twice keeps the higher preference.
+func (s *Voting) resolveBallot(msisdn, text string) (Ballot, error) {
+	prefs := splitBallot(text)
+
+	if len(prefs) > 1 {
+		// Name of candidate can contain separators itself.
+		registered, err := s.scoreKpr.IsCandidate(text)
+		if err != nil {
+			log.Println("Failed to check if candidate is registered, error:", err)
+			return nil, err
+		}
+		if registered {
+			return Ballot{text}, nil
+		}
+	}
+
+	if len(prefs) <= 1 {
+		cand, err := s.resolveCandidate(msisdn, text)
+		if err != nil || cand == "" {
+			return nil, err
+		}
+
+		return Ballot{cand}, nil
+	}
+
+	candidates, aliases, err := s.candidates()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ballot    Ballot
+		seen      = make(map[string]bool, len(prefs))
+		unknown   []string
+		ambiguous []ambiguity
+	)
+
+	for _, p := range prefs {
+		cand, options := s.matcher.Match(p, candidates, aliases)
+		switch {
+		case cand == "" && len(options) > 0:
+			ambiguous = append(ambiguous, ambiguity{text: p, options: options})
+		case cand == "":
+			unknown = append(unknown, p)
+		case !seen[cand]:
+			seen[cand] = true
+			ballot = append(ballot, cand)
+		}
+	}
+
+	if len(unknown) == 0 && len(ambiguous) == 0 {
+		log.Printf("Message: %q matched ballot: %q", text, ballot)
+		return ballot, nil
+	}
+
+	if len(unknown) > 0 {
+		log.Printf("Ballot names unknown candidates: %q, counted as invalid.", unknown)
+		if err = s.scoreKpr.AddInvalidVote(); err != nil {
+			log.Println("Invalid votes counter was not incremented, error:", err)
+		}
+	} else {
+		log.Printf("Ballot: %q is ambiguous, asking voter to clarify.", text)
+	}
+
+	s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, ballotReply(unknown, ambiguous, candidates))
+
+	return nil, nil
+}
+
+// ambiguity is a preference that is equally close to several candidates.
+type ambiguity struct {
+	text    string
+	options []string
+}
+
+// ballotReply builds single reply for a voter whose ballot has preferences that could not be resolved.
+// Lists all of them, so the voter can fix the whole ballot at once.
+func ballotReply(unknown []string, ambiguous []ambiguity, candidates []string) string {
+	var parts []string
+
+	switch len(unknown) {
+	case 0:
+	case 1:
+		parts = append(parts, "Unknown candidate: "+unknown[0]+".")
+	default:
+		parts = append(parts, "Unknown candidates: "+strings.Join(unknown, ", ")+".")
+	}
+
+	for _, a := range ambiguous {
+		parts = append(parts, "Did you mean "+strings.Join(a.options, " or ")+" instead of "+a.text+"?")
+	}
+
+	if len(unknown) > 0 && len(candidates) > 0 {
+		sorted := append([]string(nil), candidates...)
+		sort.Strings(sorted)
+		parts = append(parts, "Please vote for some of: "+strings.Join(sorted, ", ")+".")
+	} else {
+		parts = append(parts, "Please send the names again.")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// encode serializes ballot for storage.
+func (b Ballot) encode() string {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// decodeBallots reads stored ballots, broken ones are skipped.
+func decodeBallots(data []string) []Ballot {
+	ballots := make([]Ballot, 0, len(data))
+
+	for _, d := range data {
+		var b Ballot
+		if err := json.Unmarshal([]byte(d), &b); err != nil {
+			log.Printf("Ballot %q is broken, skipped. Error: %q", d, err)
+			continue
+		}
+		ballots = append(ballots, b)
+	}
+
+	return ballots
+}
@@ -0,0 +1,64 @@
+package voting
+
+import "sync"
+
+// Publisher is notified every time score of an event changes.
+type Publisher interface {
+	Publish(eventID string)
+}
+
+// Bus is an in-process Publisher. Notifications are coalesced: subscriber that is busy
+// gets a single notification for all changes that happened meanwhile, so publisher never blocks.
+// It only knows about votes processed by this instance.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]chan struct{}
+}
+
+// NewBus creates bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string][]chan struct{})}
+}
+
+// Subscribe returns channel that receives notifications about changes of given event.
+func (b *Bus) Subscribe(eventID string) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subs[eventID] = append(b.subs[eventID], ch)
+	b.mu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe stops notifications to the channel returned by Subscribe.
+func (b *Bus) Unsubscribe(eventID string, ch <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subs[eventID]
+	for i, s := range subs {
+		if s == ch {
+			b.subs[eventID] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(b.subs[eventID]) == 0 {
+		delete(b.subs, eventID)
+	}
+}
+
+// Publish notifies all subscribers of the event.
+func (b *Bus) Publish(eventID string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subs[eventID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Subscriber has pending notification already.
+		}
+	}
+}
@@ -6,6 +6,8 @@ import "log"
 type Registry interface {
 	AddCandidate(name string) error
 	RemoveCandidate(name string) error
+	AddAlias(alias, name string) error
+	RemoveAlias(alias string) error
 }
 
 // CandidatesSvc provides API for candidates.
@@ -39,3 +41,23 @@ func (c *CandidatesSvc) Del(name string) error {
 
 	return err
 }
+
+// AddAlias registers alternative spelling or short code that counts as a vote for candidate.
+func (c *CandidatesSvc) AddAlias(alias, name string) error {
+	err := c.registry.AddAlias(alias, name)
+	if err != nil {
+		log.Println("Alias add failed, error:", err)
+	}
+
+	return err
+}
+
+// DelAlias removes alias, candidate itself is not affected.
+func (c *CandidatesSvc) DelAlias(alias string) error {
+	err := c.registry.RemoveAlias(alias)
+	if err != nil {
+		log.Println("Alias was not deleted, error:", err)
+	}
+
+	return err
+}
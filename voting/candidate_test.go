@@ -7,6 +7,8 @@ type NastyError error
 type MockedRegistry struct {
 	AddCandidateFunc    func(name string) error
 	RemoveCandidateFunc func(name string) error
+	AddAliasFunc        func(alias, name string) error
+	RemoveAliasFunc     func(alias string) error
 }
 
 func (mr *MockedRegistry) AddCandidate(name string) error {
@@ -17,6 +19,14 @@ func (mr *MockedRegistry) RemoveCandidate(name string) error {
 	return mr.RemoveCandidateFunc(name)
 }
 
+func (mr *MockedRegistry) AddAlias(alias, name string) error {
+	return mr.AddAliasFunc(alias, name)
+}
+
+func (mr *MockedRegistry) RemoveAlias(alias string) error {
+	return mr.RemoveAliasFunc(alias)
+}
+
 func TestNewCandidatesCreatesInstanceWithGivenRegistry(t *testing.T) {
 	registry := &MockedRegistry{}
 
@@ -116,3 +126,24 @@ func TestDelReturnsErrorIfRegistryDid(t *testing.T) {
 		t.Error("Error differs from the one we expect.")
 	}
 }
+
+func TestAddAliasTrigersRegistryAddAlias(t *testing.T) {
+	var aliases = make(map[string]string)
+
+	registry := &MockedRegistry{
+		AddAliasFunc: func(alias, name string) error {
+			aliases[alias] = name
+			return nil
+		},
+	}
+
+	svc := NewCandidates(registry)
+	err := svc.AddAlias("1", "Max")
+	if err != nil {
+		t.Error("Error occurred did not expect that.")
+	}
+
+	if aliases["1"] != "Max" {
+		t.Error("Alias was not added.")
+	}
+}
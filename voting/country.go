@@ -0,0 +1,92 @@
+package voting
+
+import (
+	"errors"
+	"log"
+	"sort"
+)
+
+// ErrUnknownCountry is returned when no votes were counted from requested country.
+var ErrUnknownCountry = errors.New("no votes from country")
+
+// CountryStats holds scores of candidates within single country.
+type CountryStats struct {
+	Country    string
+	Total      int
+	Candidates []StatItem // The most voted candidate goes first.
+}
+
+// GetCountryStats returns scores of candidates that got votes from given country.
+// Results of closed event are returned as they were at the moment of closing.
+func (s *Voting) GetCountryStats(code string) (CountryStats, error) {
+	state, err := s.State()
+	if err != nil {
+		return CountryStats{}, err
+	}
+
+	var items []StatItem
+
+	if state == Closed || state == Archived {
+		stats, err := s.frozenStats()
+		if err != nil {
+			return CountryStats{}, err
+		}
+		items = stats.ByCountry[code]
+	} else {
+		matrix, err := s.scoreKpr.GetCountryCandidates([]string{code})
+		if err != nil {
+			log.Printf("Failed to get scores within country %q, error: %q", code, err)
+			return CountryStats{}, err
+		}
+		items = rankItems(matrix[code])
+	}
+
+	if len(items) == 0 {
+		return CountryStats{}, ErrUnknownCountry
+	}
+
+	cs := CountryStats{Country: code, Candidates: items}
+	for _, it := range items {
+		cs.Total += it.Value
+	}
+
+	return cs, nil
+}
+
+// countryMatrix reads scores of candidates within every given country at once.
+// Returns nil if they could not be read, matrix is left out of stats until next update then.
+func (s *Voting) countryMatrix(countries []string) map[string][]StatItem {
+	matrix := make(map[string][]StatItem, len(countries))
+	if len(countries) == 0 {
+		return matrix
+	}
+
+	scores, err := s.scoreKpr.GetCountryCandidates(countries)
+	if err != nil {
+		log.Printf("Failed to get scores within %d countries, error: %q", len(countries), err)
+		return nil
+	}
+
+	for _, c := range countries {
+		matrix[c] = rankItems(scores[c])
+	}
+
+	return matrix
+}
+
+// rankItems turns scores into items, the highest score first. Ties are ordered by name, so order is stable.
+func rankItems(scores map[string]int) []StatItem {
+	items := make([]StatItem, 0, len(scores))
+	for name, v := range scores {
+		items = append(items, StatItem{Name: name, Value: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Value != items[j].Value {
+			return items[i].Value > items[j].Value
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	return items
+}
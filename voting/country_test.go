@@ -0,0 +1,48 @@
+package voting
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCountryStatsRanksCandidates(t *testing.T) {
+	state := Open
+	frozen := `{"ByCountry": {"UKR": [{"Name": "Lordi", "Value": 5}]}}`
+
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: func() (string, error) {
+				return string(state), nil
+			},
+			GetFrozenResultsFunc: func() (string, error) {
+				return frozen, nil
+			},
+			GetCountryCandidatesFunc: func(codes []string) (map[string]map[string]int, error) {
+				matrix := map[string]map[string]int{"UKR": {"ABBA": 1, "Loreen": 3, "Lordi": 3}}
+				return map[string]map[string]int{codes[0]: matrix[codes[0]]}, nil
+			},
+		},
+		NewBus(),
+		Event{},
+	)
+
+	stats, err := svc.GetCountryStats("UKR")
+	expected := CountryStats{Country: "UKR", Total: 7, Candidates: []StatItem{{"Lordi", 3}, {"Loreen", 3}, {"ABBA", 1}}}
+	if err != nil || !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Stats: %+v, error: %v, expected %+v", stats, err, expected)
+	}
+
+	if _, err = svc.GetCountryStats("SWE"); err != ErrUnknownCountry {
+		t.Errorf("Error: %v, expected %v", err, ErrUnknownCountry)
+	}
+
+	state = Closed
+
+	stats, err = svc.GetCountryStats("UKR")
+	expected = CountryStats{Country: "UKR", Total: 5, Candidates: []StatItem{{"Lordi", 5}}}
+	if err != nil || !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Frozen stats: %+v, error: %v, expected %+v", stats, err, expected)
+	}
+}
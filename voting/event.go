@@ -0,0 +1,259 @@
+package voting
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// maxSenderLen is a limit of alphanumeric SMS originator.
+const maxSenderLen = 11
+
+var (
+	// ErrInvalidEvent is returned when event can not be added because of its configuration.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrEventNotFound is returned when there is no event with requested ID.
+	ErrEventNotFound = errors.New("event not found")
+	// ErrEventConflict is returned when messages of the new event can not be told apart from messages of existing one.
+	ErrEventConflict = errors.New("event routing conflicts with existing event")
+
+	validEventID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Event is a single voting campaign. Every event has its own candidates, isolated score and rules.
+// Incoming message is routed to event by recipient number (VMN) and/or keyword, the first word of the message.
+// Event can be opened and closed manually or by schedule.
+type Event struct {
+	ID           string
+	Sender       string // Originator of reply messages, defaults to ID.
+	VMN          string // Virtual mobile number that receives votes, empty to accept on any number.
+	Keyword      string // Optional. Message must start with it to be routed to this event.
+	MaxDistance  int    // Max number of typos in candidate name.
+	Policy       Policy
+	OpensAt      time.Time // Optional. Draft event is opened at this time.
+	ClosesAt     time.Time // Optional. Open event is closed at this time.
+	OutsideReply string    // Reply to votes that come when event is not open.
+	Scoring      Scoring   // How votes are turned into points on the leaderboard.
+}
+
+// Storage persists score and candidates of a single event.
+type Storage interface {
+	ScoreKeeper
+	Registry
+}
+
+// EventStore persists configuration of all events.
+type EventStore interface {
+	SaveEvent(id, data string) error
+	RemoveEvent(id string) error
+	GetEvents() (map[string]string, error)
+}
+
+// eventSvc holds services of a single event.
+type eventSvc struct {
+	Event
+	votes *Voting
+	cands *CandidatesSvc
+}
+
+// Events manages all voting events served by this instance and routes votes between them.
+type Events struct {
+	store     EventStore
+	messenger Messenger
+	enquirer  Enquirer
+	publisher Publisher
+	storage   func(eventID string) Storage
+
+	mu     sync.RWMutex
+	events map[string]*eventSvc
+}
+
+// NewEvents creates events manager. Storage is called once per event to get its isolated storage.
+func NewEvents(st EventStore, m Messenger, en Enquirer, pub Publisher, storage func(eventID string) Storage) *Events {
+	return &Events{
+		store:     st,
+		messenger: m,
+		enquirer:  en,
+		publisher: pub,
+		storage:   storage,
+		events:    make(map[string]*eventSvc),
+	}
+}
+
+// Load restores all events that were added previously.
+func (e *Events) Load() error {
+	stored, err := e.store.GetEvents()
+	if err != nil {
+		log.Println("Failed to load events, error:", err)
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, data := range stored {
+		var ev Event
+		if err = json.Unmarshal([]byte(data), &ev); err != nil {
+			log.Printf("Event %q skipped, configuration is broken: %q", id, err)
+			continue
+		}
+		e.events[ev.ID] = e.newEventSvc(ev)
+	}
+
+	return nil
+}
+
+// Add creates new event or updates configuration of existing one.
+func (e *Events) Add(ev Event) error {
+	if !validEventID.MatchString(ev.ID) {
+		return ErrInvalidEvent
+	}
+
+	if ev.Sender == "" {
+		ev.Sender = ev.ID
+	}
+
+	if len(ev.Sender) > maxSenderLen {
+		return ErrInvalidEvent
+	}
+
+	if !ev.OpensAt.IsZero() && !ev.ClosesAt.IsZero() && !ev.ClosesAt.After(ev.OpensAt) {
+		return ErrInvalidEvent
+	}
+
+	if !ev.Scoring.valid() {
+		return ErrInvalidEvent
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, other := range e.events {
+		if other.ID != ev.ID && other.VMN == ev.VMN && strings.EqualFold(other.Keyword, ev.Keyword) {
+			return ErrEventConflict
+		}
+	}
+
+	if err = e.store.SaveEvent(ev.ID, string(data)); err != nil {
+		log.Printf("Event %q was not saved, error: %q", ev.ID, err)
+		return err
+	}
+
+	e.events[ev.ID] = e.newEventSvc(ev)
+
+	return nil
+}
+
+// Remove stops serving event. Its score stays in storage.
+func (e *Events) Remove(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.events[id]; !ok {
+		return ErrEventNotFound
+	}
+
+	if err := e.store.RemoveEvent(id); err != nil {
+		log.Printf("Event %q was not removed, error: %q", id, err)
+		return err
+	}
+
+	delete(e.events, id)
+
+	return nil
+}
+
+// List returns configuration of all events ordered by ID.
+func (e *Events) List() []Event {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	list := make([]Event, 0, len(e.events))
+	for _, ev := range e.events {
+		list = append(list, ev.Event)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list
+}
+
+// Get returns services of event with given ID.
+func (e *Events) Get(id string) (Votes, Candidates, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ev, ok := e.events[id]
+	if !ok {
+		return nil, nil, false
+	}
+
+	return ev.votes, ev.cands, true
+}
+
+// Route finds event that message sent to recipient number belongs to.
+// Event with matching keyword wins, keyword is stripped from the text.
+// Otherwise event bound to recipient number is used, then fallback event.
+func (e *Events) Route(recipient, text, fallback string) (Votes, string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	keyword, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i > 0 {
+		keyword, rest = text[:i], strings.TrimSpace(text[i:])
+	}
+
+	// Event bound to the number is more specific than the one that accepts messages on any number.
+	var byKeyword, byVMN *eventSvc
+
+	for _, ev := range e.events {
+		if ev.VMN != "" && ev.VMN != recipient {
+			continue
+		}
+
+		switch {
+		case ev.Keyword != "" && strings.EqualFold(ev.Keyword, keyword):
+			if ev.VMN != "" {
+				return ev.votes, rest, true
+			}
+			byKeyword = ev
+		case ev.Keyword == "" && ev.VMN != "":
+			byVMN = ev
+		}
+	}
+
+	if byKeyword != nil {
+		return byKeyword.votes, rest, true
+	}
+
+	if byVMN != nil {
+		return byVMN.votes, text, true
+	}
+
+	if ev, ok := e.events[fallback]; ok {
+		return ev.votes, text, true
+	}
+
+	return nil, text, false
+}
+
+func (e *Events) newEventSvc(ev Event) *eventSvc {
+	st := e.storage(ev.ID)
+
+	return &eventSvc{
+		Event: ev,
+		votes: New(e.messenger, e.enquirer, st, e.publisher, ev),
+		cands: NewCandidates(st),
+	}
+}
@@ -0,0 +1,146 @@
+package voting
+
+import "testing"
+
+type EventStoreMock struct {
+	SaveEventFunc   func(id, data string) error
+	RemoveEventFunc func(id string) error
+	GetEventsFunc   func() (map[string]string, error)
+}
+
+func (es *EventStoreMock) SaveEvent(id, data string) error {
+	return es.SaveEventFunc(id, data)
+}
+
+func (es *EventStoreMock) RemoveEvent(id string) error {
+	return es.RemoveEventFunc(id)
+}
+
+func (es *EventStoreMock) GetEvents() (map[string]string, error) {
+	return es.GetEventsFunc()
+}
+
+type StorageMock struct {
+	*SkoreKprMock
+	*MockedRegistry
+}
+
+func newTestEvents(stored map[string]string) *Events {
+	return NewEvents(
+		&EventStoreMock{
+			SaveEventFunc: func(id, data string) error {
+				stored[id] = data
+				return nil
+			},
+			RemoveEventFunc: func(id string) error {
+				delete(stored, id)
+				return nil
+			},
+			GetEventsFunc: func() (map[string]string, error) {
+				return stored, nil
+			},
+		},
+		&MessengerMock{},
+		&EnquirerMock{},
+		NewBus(),
+		func(id string) Storage {
+			return StorageMock{&SkoreKprMock{}, &MockedRegistry{}}
+		},
+	)
+}
+
+func TestAddEventIsPersistedAndLoaded(t *testing.T) {
+	stored := make(map[string]string)
+
+	err := newTestEvents(stored).Add(Event{ID: "Eurovision", VMN: "3197010260000"})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	events := newTestEvents(stored)
+	if err = events.Load(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	list := events.List()
+	if len(list) != 1 || list[0].ID != "Eurovision" || list[0].VMN != "3197010260000" {
+		t.Errorf("Unexpected events after load: %+v", list)
+	}
+
+	if list[0].Sender != "Eurovision" {
+		t.Errorf("Sender is %q, expected event ID to be used", list[0].Sender)
+	}
+}
+
+func TestAddEventValidatesConfiguration(t *testing.T) {
+	events := newTestEvents(make(map[string]string))
+
+	cases := []struct {
+		ev       Event
+		expected error
+	}{
+		{Event{ID: "Show"}, nil},
+		{Event{ID: ""}, ErrInvalidEvent},
+		{Event{ID: "a:b"}, ErrInvalidEvent},
+		{Event{ID: "Long", Sender: "VeryLongSenderName"}, ErrInvalidEvent},
+		{Event{ID: "Points", Scoring: Scoring{Points: []int{10, 12}}}, ErrInvalidEvent},
+		{Event{ID: "Jury", Scoring: Scoring{Jury: map[string][]string{"NL": {"ABBA", "ABBA"}}}}, ErrInvalidEvent},
+		{Event{ID: "Self", Scoring: Scoring{ExcludeSelf: true}}, ErrInvalidEvent},
+		{Event{ID: "Other"}, ErrEventConflict},
+		{Event{ID: "Other", Keyword: "other"}, nil},
+		{Event{ID: "Third", Keyword: "OTHER"}, ErrEventConflict},
+	}
+
+	for _, c := range cases {
+		if err := events.Add(c.ev); err != c.expected {
+			t.Errorf("Adding %+v returned %v, expected %v", c.ev, err, c.expected)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	events := newTestEvents(make(map[string]string))
+
+	for _, ev := range []Event{
+		{ID: "Default"},
+		{ID: "ByVMN", VMN: "111"},
+		{ID: "ByKeyword", Keyword: "song"},
+		{ID: "ByBoth", VMN: "111", Keyword: "song"},
+	} {
+		if err := events.Add(ev); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	cases := []struct {
+		recipient, text string
+		event, rest     string
+	}{
+		{"222", "ABBA", "Default", "ABBA"},
+		{"111", "ABBA", "ByVMN", "ABBA"},
+		{"222", "SONG ABBA", "ByKeyword", "ABBA"},
+		{"111", "song  Lordi", "ByBoth", "Lordi"},
+		{"111", "songs", "ByVMN", "songs"},
+	}
+
+	for _, c := range cases {
+		votes, rest, ok := events.Route(c.recipient, c.text, "Default")
+		if !ok {
+			t.Errorf("Message %q to %q was not routed", c.text, c.recipient)
+			continue
+		}
+
+		expected, _, _ := events.Get(c.event)
+		if votes != expected {
+			t.Errorf("Message %q to %q routed to wrong event, expected %q", c.text, c.recipient, c.event)
+		}
+
+		if rest != c.rest {
+			t.Errorf("Message %q to %q has text %q, expected %q", c.text, c.recipient, rest, c.rest)
+		}
+	}
+
+	if _, _, ok := events.Route("222", "ABBA", "Missing"); ok {
+		t.Error("Message routed, expected no event to be found")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,104 +16,280 @@ var upgrader = websocket.Upgrader{}
 
 const (
 	statsHTML    = "/opt/gokiezen/stats.html"
-	updatePeriod = 1 // WebSocket send period in seconds.
+	updatePeriod = 1  // Min time between WebSocket updates in seconds. Changes within this period are sent together.
+	resyncPeriod = 30 // Stats are reread after this number of seconds even if no changes were published.
+
+	eventsPath         = "/events/"
+	statsCountriesPath = "/stats/countries/"
+
+	writeWait  = 10 * time.Second  // Time allowed to write a message to WebSocket.
+	pongWait   = 60 * time.Second  // Time allowed to get pong from WebSocket client.
+	pingPeriod = pongWait * 9 / 10 // Must be less than pongWait.
 )
 
 // Votes is capable of processing vote SMS messages.
 type Votes interface {
 	GetStats() (Stats, error)
+	GetCountryStats(code string) (CountryStats, error)
+	GetResults(method string) (Results, error)
 	RegisterVote(msisdn, text string) error
+	State() (State, error)
+	Open() error
+	Close() error
+	Archive() error
 }
 
 // Candidates can add and delete candidates.
 type Candidates interface {
 	Add(name string) error
 	Del(name string) error
+	AddAlias(alias, name string) error
+	DelAlias(alias string) error
+}
+
+// EventRegistry manages voting events and finds the one that request is addressed to.
+type EventRegistry interface {
+	Add(ev Event) error
+	Remove(id string) error
+	List() []Event
+	Get(id string) (Votes, Candidates, bool)
+	Route(recipient, text, fallback string) (Votes, string, bool)
 }
 
-// Message is a struct that we expect on web-hook endpoint when SMS was sent to us.
-type Message struct {
-	Originator string
-	Body       string
+// eventView is event configuration together with its current state.
+type eventView struct {
+	Event
+	State State
 }
 
+// Inbox remembers inbound messages that were processed, so retried web-hook does not count vote twice.
+// Claim returns state message was in before, empty string if it was not seen and is claimed now.
+type Inbox interface {
+	Claim(id string) (string, error)
+	Done(id string) error
+	Release(id string) error
+}
+
+// States of inbound message reported by Inbox.
+const (
+	messageProcessing = "processing" // Vote is not stored yet, message is not acknowledged.
+	messageDone       = "done"
+)
+
 // Controller is responsible for requests parsing and responses serialization.
+// Endpoints without event ID in the path serve default event.
 type Controller struct {
-	voteSvc   Votes
-	candsSvc  Candidates
-	statsChan chan Stats
+	events       EventRegistry
+	bus          *Bus
+	inbox        Inbox
+	parser       InboundParser
+	defaultEvent string
+
+	mu   sync.Mutex
+	hubs map[string]*Hub // WebSocket subscribers of every event that was subscribed to.
 }
 
 // NewController is a constructor for Controller instance.
-func NewController(v Votes, c Candidates) *Controller {
+func NewController(ev EventRegistry, bus *Bus, inbox Inbox, parser InboundParser, defaultEvent string) *Controller {
 	ctrl := &Controller{
-		voteSvc:   v,
-		candsSvc:  c,
-		statsChan: make(chan Stats),
+		events:       ev,
+		bus:          bus,
+		inbox:        inbox,
+		parser:       parser,
+		defaultEvent: defaultEvent,
+		hubs:         make(map[string]*Hub),
 	}
 
-	go ctrl.sendUpdates()
+	// Stats of default event are kept ready for the first subscriber.
+	ctrl.hub(defaultEvent)
 
 	return ctrl
 }
 
-// HandleCandidates is responsible for add/delete operations on candidates.
+// HandleCandidates is responsible for add/delete operations on candidates of default event.
 func (c *Controller) HandleCandidates(w http.ResponseWriter, req *http.Request) {
+	_, cands, ok := c.events.Get(c.defaultEvent)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if handleCandidates(w, req, cands) {
+		c.bus.Publish(c.defaultEvent)
+	}
+}
+
+// GetStats returns statistics with current voting data of default event.
+// Votes by operator and number type hold N/A for voters whose number was resolved offline.
+func (c *Controller) GetStats(w http.ResponseWriter, req *http.Request) {
+	votes, _, ok := c.events.Get(c.defaultEvent)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	getStats(w, req, votes)
+}
+
+// GetCountryStats returns scores of candidates within country of default event: /stats/countries/{code}.
+func (c *Controller) GetCountryStats(w http.ResponseWriter, req *http.Request) {
+	votes, _, ok := c.events.Get(c.defaultEvent)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	getCountryStats(w, req, votes, strings.TrimPrefix(req.URL.Path, statsCountriesPath))
+}
+
+// GetResults returns leaderboard of default event. Counting method is chosen with method parameter: /results?method=irv.
+func (c *Controller) GetResults(w http.ResponseWriter, req *http.Request) {
+	votes, _, ok := c.events.Get(c.defaultEvent)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	getResults(w, req, votes)
+}
+
+// HandleEvents lists all events on GET and creates or updates event on POST, event is expected as JSON body.
+func (c *Controller) HandleEvents(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
-	case "POST":
-		p := req.FormValue("name")
-		if p == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "name parameter must be provided")
-			return
+	case "GET":
+		list := c.events.List()
+		views := make([]eventView, 0, len(list))
+		for _, ev := range list {
+			v := eventView{Event: ev}
+			if votes, _, ok := c.events.Get(ev.ID); ok {
+				// State is informational here, event is listed even if it can not be resolved.
+				v.State, _ = votes.State()
+			}
+			views = append(views, v)
 		}
-		err := c.candsSvc.Add(p)
+
+		err := json.NewEncoder(w).Encode(views)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			log.Println("Failed to serialize events response, error:", err)
 		}
-		w.WriteHeader(http.StatusCreated)
-	case "DELETE":
-		p := req.FormValue("name")
-		if p == "" {
+	case "POST":
+		var ev Event
+		err := json.NewDecoder(req.Body).Decode(&ev)
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "name parameter must be provided")
+			fmt.Fprint(w, "event must be provided as JSON body")
 			return
 		}
-		err := c.candsSvc.Del(p)
-		if err != nil {
+
+		switch err = c.events.Add(ev); err {
+		case nil:
+			w.WriteHeader(http.StatusCreated)
+		case ErrInvalidEvent, ErrEventConflict:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+		default:
 			w.WriteHeader(http.StatusInternalServerError)
-			return
 		}
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// GetStats returns statistics with current voting data.
-func (c *Controller) GetStats(w http.ResponseWriter, req *http.Request) {
-	// Fail early.
-	if req.Method != "GET" {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+// HandleEvent serves endpoints of a single event:
+// DELETE /events/{id}, /events/{id}/stats, /events/{id}/stats/ws, /events/{id}/stats/countries/{code}, /events/{id}/results
+// and /events/{id}/candidates.
+// Lifecycle is managed with POST to /events/{id}/open, /events/{id}/close and /events/{id}/archive.
+func (c *Controller) HandleEvent(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, eventsPath), "/")
+	id := parts[0]
+
+	votes, cands, ok := c.events.Get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	stats, err := c.voteSvc.GetStats()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if len(parts) == 1 {
+		if req.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := c.events.Remove(id); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(stats)
-	if err != nil {
-		log.Println("Failed to serialize stats response, error:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	switch parts[1] {
+	case "stats":
+		if len(parts) == 3 && parts[2] == "ws" {
+			serveWS(w, req, c.hub(id))
+			return
+		}
+		if len(parts) > 3 && parts[2] == "countries" {
+			// Code of unresolved country contains a slash.
+			getCountryStats(w, req, votes, strings.Join(parts[3:], "/"))
+			return
+		}
+		getStats(w, req, votes)
+	case "results":
+		getResults(w, req, votes)
+	case "candidates":
+		if handleCandidates(w, req, cands) {
+			c.bus.Publish(id)
+		}
+	case "open":
+		changeState(w, req, votes.Open)
+	case "close":
+		changeState(w, req, votes.Close)
+	case "archive":
+		changeState(w, req, votes.Archive)
+	default:
+		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
-// GetStatsWS returns statistics with current voting data via WebSocket.
+// GetStatsWS returns statistics with current voting data of default event via WebSocket.
 func (c *Controller) GetStatsWS(w http.ResponseWriter, req *http.Request) {
+	if _, _, ok := c.events.Get(c.defaultEvent); !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	serveWS(w, req, c.hub(c.defaultEvent))
+}
+
+// hub returns hub of the event. Hub is created by the first subscriber, stats of the event are read
+// and broadcast from then on, until event is removed.
+func (c *Controller) hub(id string) *Hub {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.hubs[id]
+	if !ok {
+		h = NewHub()
+		c.hubs[id] = h
+		go c.sendUpdates(id, h)
+	}
+
+	return h
+}
+
+// dropHub closes hub of removed event, its subscribers are disconnected.
+func (c *Controller) dropHub(id string, h *Hub) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hubs[id] == h {
+		delete(c.hubs, id)
+	}
+	h.Close()
+}
+
+// serveWS sends statistics published to the hub via WebSocket.
+// Client gets full snapshot on connect, then updates with changed counters, see Update.
+// Connection is kept alive with pings, client that does not answer with pong is dropped.
+func serveWS(w http.ResponseWriter, req *http.Request, hub *Hub) {
 	conn, err := upgrader.Upgrade(w, req, nil)
 	if err != nil {
 		log.Println("Failed upgrading to WebSocket, error:", err)
@@ -120,44 +297,128 @@ func (c *Controller) GetStatsWS(w http.ResponseWriter, req *http.Request) {
 	}
 	defer conn.Close()
 
-	var update Stats
+	updates := hub.Register()
+	defer hub.Unregister(updates)
+
+	go readPongs(conn)
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
 
 	for {
-		update = <-c.statsChan
+		select {
+		case update, ok := <-updates:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				log.Println("WebSocket client is too slow or event was removed. Dropping connection.")
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
 
-		err = conn.WriteJSON(update)
-		if err != nil {
-			log.Println("Write to WebSocket failed. Dropping connection. Error:", err)
-			break
+			if err = conn.WriteMessage(websocket.TextMessage, update); err != nil {
+				log.Println("Write to WebSocket failed. Dropping connection. Error:", err)
+				return
+			}
+		case <-ping.C:
+			if err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				log.Println("Ping to WebSocket failed. Dropping connection. Error:", err)
+				return
+			}
+		}
+	}
+}
+
+// readPongs processes control messages from the client. Clients are not expected to send anything else.
+// Read fails when client is gone or pong did not come in time, that closes the connection.
+func readPongs(conn *websocket.Conn) {
+	defer conn.Close()
+
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
 		}
 	}
 }
 
 // HandleVote accepts requests with SMS data and passes this data to service responsible for processing.
+// Vote goes to event that is bound to recipient number or keyword, default event otherwise.
+// Message that was processed already is acknowledged without processing, SMS service retries web-hooks on failures.
+// Success is returned only after vote is stored, so failed message is retried. Retry that comes while message is still
+// processing gets conflict status, it is not acknowledged until vote is stored.
 func (c *Controller) HandleVote(w http.ResponseWriter, req *http.Request) {
-	// Expecting only POST from messaging service.
-	if req.Method != "POST" {
+	// Expecting GET or POST from messaging service.
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	var msg Message
-	err := json.NewDecoder(req.Body).Decode(&msg)
+	defer req.Body.Close()
+
+	msg, err := c.parser.ParseInbound(req)
 	if err != nil {
-		log.Println("Request body is not valid, error:", err)
+		log.Println("Request is not a valid inbound message, error:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	defer req.Body.Close()
+	votes, text, ok := c.events.Route(msg.Recipient, strings.TrimSpace(msg.Body), c.defaultEvent)
+	if !ok {
+		// Message is logged in full, so it can be counted by hand once event it was meant for is known.
+		log.Printf("No event for message %q to: %q from MSISDN: %q, text: %q. Message dropped.", msg.ID, msg.Recipient, msg.Originator, msg.Body)
+		return
+	}
+
+	if msg.ID != "" {
+		state, err := c.inbox.Claim(msg.ID)
+		if err != nil {
+			log.Printf("Failed to claim message %q, error: %q", msg.ID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-	msg.Body = strings.TrimSpace(msg.Body)
+		switch state {
+		case "":
+		case messageProcessing:
+			log.Printf("Message %q is being processed, retry is not acknowledged.", msg.ID)
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			log.Printf("Message %q was processed already, skipped.", msg.ID)
+			return
+		}
+	}
 
-	err = c.voteSvc.RegisterVote(msg.Originator, msg.Body)
+	err = votes.RegisterVote(msg.Originator, text)
 	if err != nil {
+		c.release(msg.ID)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	if msg.ID == "" {
+		return
+	}
+
+	if err = c.inbox.Done(msg.ID); err != nil {
+		log.Printf("Failed to mark message %q as processed, retry can count it again, error: %q", msg.ID, err)
+	}
+}
+
+// release forgets message that failed, so it is processed again when SMS service retries.
+func (c *Controller) release(id string) {
+	if id == "" {
+		return
+	}
+
+	if err := c.inbox.Release(id); err != nil {
+		log.Printf("Failed to release message %q, retry will be skipped, error: %q", id, err)
+	}
 }
 
 // ServeHTML serves single HTML file that displays WebSocket data.
@@ -170,16 +431,208 @@ func ServeHTML(w http.ResponseWriter, req *http.Request) {
 	http.ServeFile(w, req, statsHTML)
 }
 
-func (c *Controller) sendUpdates() {
-	t := time.Tick(updatePeriod * time.Second)
+// sendUpdates broadcasts stats of the event to all WebSocket subscribers of its hub.
+// Stats are read only when change was published, not more often than once per update period,
+// so load on storage does not depend on number of subscribers. Hub is closed once event is removed.
+func (c *Controller) sendUpdates(id string, hub *Hub) {
+	changes := c.bus.Subscribe(id)
+	defer c.bus.Unsubscribe(id, changes)
+
+	resync := time.NewTicker(resyncPeriod * time.Second)
+	defer resync.Stop()
+
+	var (
+		prev Stats
+		seq  uint64
+	)
+
+	for {
+		votes, _, ok := c.events.Get(id)
+		if !ok {
+			log.Printf("Event %q is not served anymore, its WebSocket subscribers are dropped.", id)
+			c.dropHub(id, hub)
+			return
+		}
+
+		if stats, ok := readStats(votes); ok {
+			if update, changed := nextUpdate(prev, stats, seq); changed {
+				broadcast(hub, update, stats)
+				prev, seq = stats, update.Seq
+			}
+		}
+
+		time.Sleep(updatePeriod * time.Second)
+
+		select {
+		case <-changes:
+		case <-resync.C:
+		}
+	}
+}
+
+// readStats returns current stats of the event.
+func readStats(votes Votes) (Stats, bool) {
+	stats, err := votes.GetStats()
+	if err != nil {
+		log.Printf("Update was not propagated, time: %v, error: %q\n", time.Now(), err)
+		return Stats{}, false
+	}
+
+	return stats, true
+}
+
+// broadcast sends update to subscribers, full stats become snapshot for new subscribers.
+func broadcast(hub *Hub, update Update, stats Stats) {
+	msg, err := json.Marshal(update)
+	if err != nil {
+		log.Println("Failed to serialize stats update, error:", err)
+		return
+	}
+
+	snapshot, err := json.Marshal(Update{Seq: update.Seq, Full: true, Stats: stats})
+	if err != nil {
+		log.Println("Failed to serialize stats snapshot, error:", err)
+		return
+	}
+
+	hub.Broadcast(msg, snapshot)
+}
 
-	for now := range t {
-		stats, err := c.voteSvc.GetStats()
+// handleCandidates is responsible for add/delete operations on candidates.
+// Candidate can be added together with aliases and short codes: name=ABBA&alias=1&alias=A.
+// Delete with alias parameter removes only the alias.
+// Returns true if candidates were changed, so subscribers are notified only then.
+func handleCandidates(w http.ResponseWriter, req *http.Request, cands Candidates) bool {
+	switch req.Method {
+	case "POST":
+		p := req.FormValue("name")
+		if p == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "name parameter must be provided")
+			return false
+		}
+		err := cands.Add(p)
 		if err != nil {
-			log.Printf("Update was not propagated, time: %v, error: %q\n", now, err)
-			continue
+			w.WriteHeader(http.StatusInternalServerError)
+			return false
+		}
+		for _, a := range req.Form["alias"] {
+			if err = cands.AddAlias(a, p); err != nil {
+				// Candidate is added already, subscribers see it.
+				w.WriteHeader(http.StatusInternalServerError)
+				return true
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if a := req.FormValue("alias"); a != "" {
+			if err := cands.DelAlias(a); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return false
+			}
+			return true
+		}
+		p := req.FormValue("name")
+		if p == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "name or alias parameter must be provided")
+			return false
 		}
+		err := cands.Del(p)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return false
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return false
+	}
+
+	return true
+}
+
+// getStats returns statistics with current voting data.
+func getStats(w http.ResponseWriter, req *http.Request, votes Votes) {
+	// Fail early.
+	if req.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := votes.GetStats()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		log.Println("Failed to serialize stats response, error:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// changeState moves event to another lifecycle state.
+func changeState(w http.ResponseWriter, req *http.Request, transition func() error) {
+	if req.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch err := transition(); err {
+	case nil:
+	case ErrInvalidTransition:
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, err)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// getCountryStats returns scores of candidates within given country.
+func getCountryStats(w http.ResponseWriter, req *http.Request, votes Votes, code string) {
+	if req.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := votes.GetCountryStats(code)
+	switch err {
+	case nil:
+	case ErrUnknownCountry:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		log.Println("Failed to serialize country stats response, error:", err)
+	}
+}
+
+// getResults returns leaderboard calculated with requested method, points by scoring rules of the event by default.
+func getResults(w http.ResponseWriter, req *http.Request, votes Votes) {
+	if req.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	results, err := votes.GetResults(req.FormValue("method"))
+	switch err {
+	case nil:
+	case ErrUnknownMethod:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		c.statsChan <- stats
+	if err = json.NewEncoder(w).Encode(results); err != nil {
+		log.Println("Failed to serialize results response, error:", err)
 	}
 }
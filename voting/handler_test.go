@@ -0,0 +1,379 @@
+package voting
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type EventRegistryMock struct {
+	AddFunc    func(ev Event) error
+	RemoveFunc func(id string) error
+	ListFunc   func() []Event
+	GetFunc    func(id string) (Votes, Candidates, bool)
+	RouteFunc  func(recipient, text, fallback string) (Votes, string, bool)
+}
+
+func (er *EventRegistryMock) Add(ev Event) error {
+	return er.AddFunc(ev)
+}
+
+func (er *EventRegistryMock) Remove(id string) error {
+	return er.RemoveFunc(id)
+}
+
+func (er *EventRegistryMock) List() []Event {
+	return er.ListFunc()
+}
+
+func (er *EventRegistryMock) Get(id string) (Votes, Candidates, bool) {
+	return er.GetFunc(id)
+}
+
+func (er *EventRegistryMock) Route(recipient, text, fallback string) (Votes, string, bool) {
+	return er.RouteFunc(recipient, text, fallback)
+}
+
+type VotesMock struct {
+	GetStatsFunc        func() (Stats, error)
+	GetCountryStatsFunc func(code string) (CountryStats, error)
+	GetResultsFunc      func(method string) (Results, error)
+	RegisterVoteFunc    func(msisdn, text string) error
+	StateFunc           func() (State, error)
+	OpenFunc            func() error
+	CloseFunc           func() error
+	ArchiveFunc         func() error
+}
+
+func (v *VotesMock) GetStats() (Stats, error) {
+	return v.GetStatsFunc()
+}
+
+func (v *VotesMock) GetCountryStats(code string) (CountryStats, error) {
+	return v.GetCountryStatsFunc(code)
+}
+
+func (v *VotesMock) GetResults(method string) (Results, error) {
+	return v.GetResultsFunc(method)
+}
+
+func (v *VotesMock) RegisterVote(msisdn, text string) error {
+	return v.RegisterVoteFunc(msisdn, text)
+}
+
+func (v *VotesMock) State() (State, error) {
+	return v.StateFunc()
+}
+
+func (v *VotesMock) Open() error {
+	return v.OpenFunc()
+}
+
+func (v *VotesMock) Close() error {
+	return v.CloseFunc()
+}
+
+func (v *VotesMock) Archive() error {
+	return v.ArchiveFunc()
+}
+
+type InboxMock struct {
+	ClaimFunc   func(id string) (string, error)
+	DoneFunc    func(id string) error
+	ReleaseFunc func(id string) error
+}
+
+func (i *InboxMock) Claim(id string) (string, error) {
+	return i.ClaimFunc(id)
+}
+
+func (i *InboxMock) Done(id string) error {
+	return i.DoneFunc(id)
+}
+
+func (i *InboxMock) Release(id string) error {
+	return i.ReleaseFunc(id)
+}
+
+type CandidatesMock struct {
+	AddFunc      func(name string) error
+	DelFunc      func(name string) error
+	AddAliasFunc func(alias, name string) error
+	DelAliasFunc func(alias string) error
+}
+
+func (c *CandidatesMock) Add(name string) error {
+	return c.AddFunc(name)
+}
+
+func (c *CandidatesMock) Del(name string) error {
+	return c.DelFunc(name)
+}
+
+func (c *CandidatesMock) AddAlias(alias, name string) error {
+	return c.AddAliasFunc(alias, name)
+}
+
+func (c *CandidatesMock) DelAlias(alias string) error {
+	return c.DelAliasFunc(alias)
+}
+
+type InboundParserMock struct {
+	ParseInboundFunc func(req *http.Request) (Message, error)
+}
+
+func (ip *InboundParserMock) ParseInbound(req *http.Request) (Message, error) {
+	return ip.ParseInboundFunc(req)
+}
+
+func TestHandleVoteSkipsRetriedMessage(t *testing.T) {
+	claimed := make(map[string]string)
+	votes := 0
+	fail := true
+	var retry func() int
+
+	ctrl := &Controller{
+		events: &EventRegistryMock{
+			RouteFunc: func(recipient, text, fallback string) (Votes, string, bool) {
+				return &VotesMock{
+					RegisterVoteFunc: func(msisdn, text string) error {
+						if fail {
+							return errors.New("connection refused")
+						}
+						if retry != nil {
+							// SMS service retries while the first request is still processing.
+							if code := retry(); code != http.StatusConflict {
+								t.Errorf("Status of retry while processing: %d, expected %d", code, http.StatusConflict)
+							}
+						}
+						votes++
+						return nil
+					},
+				}, text, true
+			},
+		},
+		inbox: &InboxMock{
+			ClaimFunc: func(id string) (string, error) {
+				if state, ok := claimed[id]; ok {
+					return state, nil
+				}
+				claimed[id] = messageProcessing
+				return "", nil
+			},
+			DoneFunc: func(id string) error {
+				claimed[id] = messageDone
+				return nil
+			},
+			ReleaseFunc: func(id string) error {
+				delete(claimed, id)
+				return nil
+			},
+		},
+		parser: &InboundParserMock{
+			ParseInboundFunc: func(req *http.Request) (Message, error) {
+				return Message{ID: "e8077d80", Originator: "380661234567", Body: "ABBA"}, nil
+			},
+		},
+	}
+
+	deliver := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/track", strings.NewReader(""))
+		rec := httptest.NewRecorder()
+		ctrl.HandleVote(rec, req)
+
+		return rec.Code
+	}
+
+	if code := deliver(); code != http.StatusInternalServerError {
+		t.Errorf("Status of failed delivery: %d, expected %d", code, http.StatusInternalServerError)
+	}
+
+	fail = false
+	retry = deliver
+
+	if code := deliver(); code != http.StatusOK {
+		t.Errorf("Status of delivery: %d, expected %d", code, http.StatusOK)
+	}
+
+	retry = nil
+
+	for i := 0; i < 2; i++ {
+		if code := deliver(); code != http.StatusOK {
+			t.Errorf("Status of delivery #%d: %d, expected %d", i+3, code, http.StatusOK)
+		}
+	}
+
+	if votes != 1 {
+		t.Errorf("Vote was counted %d times, expected once", votes)
+	}
+}
+
+func TestHandleCountryStats(t *testing.T) {
+	votes := &VotesMock{
+		GetCountryStatsFunc: func(code string) (CountryStats, error) {
+			if code != "UKR" && code != unresolved {
+				return CountryStats{}, ErrUnknownCountry
+			}
+			return CountryStats{Country: code, Total: 3, Candidates: []StatItem{{"Lordi", 2}, {"ABBA", 1}}}, nil
+		},
+	}
+
+	ctrl := &Controller{
+		events: &EventRegistryMock{
+			GetFunc: func(id string) (Votes, Candidates, bool) {
+				return votes, nil, id == "eurovision"
+			},
+		},
+		defaultEvent: "eurovision",
+	}
+
+	testCases := []struct {
+		path   string
+		handle http.HandlerFunc
+		code   int
+	}{
+		{"/stats/countries/UKR", ctrl.GetCountryStats, http.StatusOK},
+		{"/stats/countries/SWE", ctrl.GetCountryStats, http.StatusNotFound},
+		{"/events/eurovision/stats/countries/UKR", ctrl.HandleEvent, http.StatusOK},
+		{"/events/eurovision/stats/countries/N/A", ctrl.HandleEvent, http.StatusOK},
+		{"/events/other/stats/countries/UKR", ctrl.HandleEvent, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		tc.handle(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if rec.Code != tc.code {
+			t.Errorf("%s: status %d, expected %d", tc.path, rec.Code, tc.code)
+		}
+
+		if tc.code == http.StatusOK && !strings.Contains(rec.Body.String(), `"Total":3`) {
+			t.Errorf("%s: body %s, expected country stats", tc.path, rec.Body)
+		}
+	}
+}
+
+func TestHandleCandidatesPublishesOnlyChanges(t *testing.T) {
+	cands := &CandidatesMock{
+		AddFunc: func(name string) error {
+			if name == "Queen" {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}
+
+	bus := NewBus()
+	ctrl := &Controller{
+		events: &EventRegistryMock{
+			GetFunc: func(id string) (Votes, Candidates, bool) {
+				return nil, cands, id == "eurovision"
+			},
+		},
+		bus:          bus,
+		defaultEvent: "eurovision",
+	}
+
+	testCases := []struct {
+		method    string
+		path      string
+		body      string
+		handle    http.HandlerFunc
+		code      int
+		published bool
+	}{
+		{http.MethodPost, "/candidates", "name=ABBA", ctrl.HandleCandidates, http.StatusCreated, true},
+		{http.MethodPost, "/candidates", "name=Queen", ctrl.HandleCandidates, http.StatusInternalServerError, false},
+		{http.MethodPost, "/candidates", "", ctrl.HandleCandidates, http.StatusBadRequest, false},
+		{http.MethodGet, "/candidates", "", ctrl.HandleCandidates, http.StatusMethodNotAllowed, false},
+		{http.MethodPost, "/events/eurovision/candidates", "name=Lordi", ctrl.HandleEvent, http.StatusCreated, true},
+		{http.MethodPut, "/events/eurovision/candidates", "", ctrl.HandleEvent, http.StatusMethodNotAllowed, false},
+	}
+
+	for _, tc := range testCases {
+		updates := bus.Subscribe("eurovision")
+
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		tc.handle(rec, req)
+
+		if rec.Code != tc.code {
+			t.Errorf("%s %s %q: status %d, expected %d", tc.method, tc.path, tc.body, rec.Code, tc.code)
+		}
+
+		published := len(updates) > 0
+		if published != tc.published {
+			t.Errorf("%s %s %q: published %t, expected %t", tc.method, tc.path, tc.body, published, tc.published)
+		}
+	}
+}
+
+func TestStatsWSServesEveryEvent(t *testing.T) {
+	events := map[string]Votes{
+		"eurovision": &VotesMock{
+			GetStatsFunc: func() (Stats, error) {
+				return Stats{Candidates: []StatItem{{"ABBA", 1}}}, nil
+			},
+		},
+		"junior": &VotesMock{
+			GetStatsFunc: func() (Stats, error) {
+				return Stats{Candidates: []StatItem{{"Lordi", 2}}}, nil
+			},
+		},
+	}
+
+	ctrl := NewController(
+		&EventRegistryMock{
+			GetFunc: func(id string) (Votes, Candidates, bool) {
+				votes, ok := events[id]
+				return votes, nil, ok
+			},
+		},
+		NewBus(),
+		&InboxMock{},
+		&InboundParserMock{},
+		"eurovision",
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats/ws", ctrl.GetStatsWS)
+	mux.HandleFunc(eventsPath, ctrl.HandleEvent)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	testCases := []struct {
+		path      string
+		candidate string
+	}{
+		{"/stats/ws", "ABBA"},
+		{"/events/junior/stats/ws", "Lordi"},
+	}
+
+	for _, tc := range testCases {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+tc.path, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to connect, error: %v", tc.path, err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var update Update
+		if err = conn.ReadJSON(&update); err != nil {
+			t.Fatalf("%s: failed to read update, error: %v", tc.path, err)
+		}
+		conn.Close()
+
+		if !update.Full || len(update.Candidates) != 1 || update.Candidates[0].Name != tc.candidate {
+			data, _ := json.Marshal(update)
+			t.Errorf("%s: got %s, expected snapshot with %s", tc.path, data, tc.candidate)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package voting
+
+import "sync"
+
+// clientBuffer is a number of updates that can wait for a slow subscriber.
+// Subscriber that falls further behind is dropped.
+const clientBuffer = 8
+
+// Hub delivers every update to all subscribers. Each subscriber has its own bounded buffer,
+// so single slow dashboard does not delay the others and publisher never blocks.
+type Hub struct {
+	mu       sync.Mutex
+	clients  map[chan []byte]struct{}
+	snapshot []byte
+	closed   bool
+}
+
+// NewHub creates hub without subscribers.
+func NewHub() *Hub {
+	return &Hub{clients: make(map[chan []byte]struct{})}
+}
+
+// Register adds subscriber. The most recent snapshot, if any, is delivered right away.
+// Channel is closed when subscriber is unregistered, dropped for being too slow or hub is closed.
+func (h *Hub) Register() chan []byte {
+	ch := make(chan []byte, clientBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch
+	}
+
+	if h.snapshot != nil {
+		ch <- h.snapshot
+	}
+	h.clients[ch] = struct{}{}
+
+	return ch
+}
+
+// Unregister removes subscriber. It is safe to call it for subscriber that was already dropped.
+func (h *Hub) Unregister(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(ch)
+}
+
+// Broadcast sends update to every subscriber. Subscribers with full buffer are dropped.
+// Snapshot already includes this update, it is delivered to subscribers that register later.
+func (h *Hub) Broadcast(msg, snapshot []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.snapshot = snapshot
+
+	for ch := range h.clients {
+		select {
+		case ch <- msg:
+		default:
+			h.remove(ch)
+		}
+	}
+}
+
+// Close drops all subscribers, those that register later are dropped right away.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for ch := range h.clients {
+		h.remove(ch)
+	}
+}
+
+// Len returns number of subscribers.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.clients)
+}
+
+func (h *Hub) remove(ch chan []byte) {
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
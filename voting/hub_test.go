@@ -0,0 +1,72 @@
+package voting
+
+import "testing"
+
+func TestBroadcastReachesEverySubscriber(t *testing.T) {
+	hub := NewHub()
+
+	first := hub.Register()
+	second := hub.Register()
+
+	hub.Broadcast([]byte("update"), []byte("snapshot"))
+
+	for _, ch := range []chan []byte{first, second} {
+		if msg := <-ch; string(msg) != "update" {
+			t.Errorf("Got %q, expected %q", msg, "update")
+		}
+	}
+}
+
+func TestRegisterDeliversSnapshot(t *testing.T) {
+	hub := NewHub()
+	hub.Broadcast([]byte("update"), []byte("snapshot"))
+
+	if msg := <-hub.Register(); string(msg) != "snapshot" {
+		t.Errorf("Got %q, expected %q", msg, "snapshot")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub()
+
+	slow := hub.Register()
+	fast := hub.Register()
+
+	for i := 0; i <= clientBuffer; i++ {
+		hub.Broadcast([]byte("update"), []byte("snapshot"))
+		<-fast
+	}
+
+	if hub.Len() != 1 {
+		t.Errorf("Hub has %d subscribers, expected slow one to be dropped", hub.Len())
+	}
+
+	for range slow {
+		// Drain buffered updates, channel must be closed afterwards.
+	}
+
+	hub.Unregister(slow)
+	hub.Unregister(fast)
+
+	if hub.Len() != 0 {
+		t.Errorf("Hub has %d subscribers, expected none", hub.Len())
+	}
+}
+
+func TestCloseDropsSubscribers(t *testing.T) {
+	hub := NewHub()
+
+	before := hub.Register()
+	hub.Close()
+	after := hub.Register()
+
+	for _, ch := range []chan []byte{before, after} {
+		if _, ok := <-ch; ok {
+			t.Error("Subscriber of closed hub got update, expected it to be dropped.")
+		}
+	}
+
+	if hub.Len() != 0 {
+		t.Errorf("Hub has %d subscribers, expected none", hub.Len())
+	}
+}
@@ -0,0 +1,177 @@
+package voting
+
+import (
+	"errors"
+	"log"
+)
+
+// State of the event lifecycle. Votes are accepted only while event is open.
+type State string
+
+// Event lifecycle: draft -> open -> closed -> archived. Closed event can be opened again, archived can not.
+const (
+	Draft    State = "draft"
+	Open     State = "open"
+	Closed   State = "closed"
+	Archived State = "archived"
+)
+
+const defaultOutsideReply = "Voting is not open, your vote was not counted."
+
+// ErrInvalidTransition is returned when event can not be moved to requested state from current one.
+var ErrInvalidTransition = errors.New("invalid event state transition")
+
+// State returns current state of the event. Scheduled opening and closing are applied here,
+// so event moves to the next state when the first request after scheduled time comes.
+func (s *Voting) State() (State, error) {
+	st, err := s.scoreKpr.GetState()
+	if err != nil {
+		log.Println("Failed to get event state, error:", err)
+		return "", err
+	}
+
+	state := State(st)
+	if state == "" {
+		state = Draft
+	}
+
+	now := s.now()
+
+	if state == Draft && !s.event.OpensAt.IsZero() && !now.Before(s.event.OpensAt) {
+		log.Printf("Event %q opened by schedule.", s.event.ID)
+		if err = s.setState(Open); err != nil {
+			log.Println("Failed to open event, error:", err)
+			return "", err
+		}
+		state = Open
+	}
+
+	if state == Open && s.closedBySchedule() {
+		log.Printf("Event %q closed by schedule.", s.event.ID)
+		if err = s.close(); err != nil {
+			return "", err
+		}
+		state = Closed
+	}
+
+	return state, nil
+}
+
+// Open starts accepting votes. Event that is past its scheduled closing time can not be opened,
+// schedule must be changed first.
+func (s *Voting) Open() error {
+	state, err := s.State()
+	if err != nil {
+		return err
+	}
+
+	if state == Archived || s.closedBySchedule() {
+		return ErrInvalidTransition
+	}
+
+	return s.setState(Open)
+}
+
+// Close stops accepting votes and freezes results.
+func (s *Voting) Close() error {
+	state, err := s.State()
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case Closed:
+		return nil
+	case Archived:
+		return ErrInvalidTransition
+	}
+
+	return s.close()
+}
+
+// Archive moves closed event to archive, it can not be opened anymore.
+func (s *Voting) Archive() error {
+	state, err := s.State()
+	if err != nil {
+		return err
+	}
+
+	if state != Closed && state != Archived {
+		return ErrInvalidTransition
+	}
+
+	return s.setState(Archived)
+}
+
+func (s *Voting) close() error {
+	// State goes first, votes that come while results are being frozen must be counted as late.
+	// ScoreKeeper checks state when vote is recorded, so vote that passed the check before closing is not counted after freezing.
+	if err := s.scoreKpr.SetState(string(Closed)); err != nil {
+		log.Println("Failed to close event, error:", err)
+		return err
+	}
+
+	if _, err := s.freeze(); err != nil {
+		return err
+	}
+
+	s.publisher.Publish(s.event.ID)
+
+	return nil
+}
+
+// setState persists new state and notifies subscribers.
+func (s *Voting) setState(state State) error {
+	if err := s.scoreKpr.SetState(string(state)); err != nil {
+		return err
+	}
+
+	s.publisher.Publish(s.event.ID)
+
+	return nil
+}
+
+func (s *Voting) closedBySchedule() bool {
+	return !s.event.ClosesAt.IsZero() && !s.now().Before(s.event.ClosesAt)
+}
+
+// acceptsVotes checks if event is open. Vote outside of voting window is counted separately
+// and voter is notified that vote did not count.
+func (s *Voting) acceptsVotes(msisdn string) (bool, error) {
+	state, err := s.State()
+	if err != nil {
+		return false, err
+	}
+
+	if state == Open {
+		return true, nil
+	}
+
+	s.refuseVote(msisdn, state)
+
+	return false, nil
+}
+
+// refuseVote counts vote that came outside of voting window and notifies voter that it did not count.
+func (s *Voting) refuseVote(msisdn string, state State) {
+	var err error
+
+	switch state {
+	case Draft:
+		log.Printf("Vote from MSISDN: %q came before event was opened.", msisdn)
+		err = s.scoreKpr.AddEarlyVote()
+	default:
+		log.Printf("Vote from MSISDN: %q came after event was closed.", msisdn)
+		err = s.scoreKpr.AddLateVote()
+	}
+
+	if err != nil {
+		log.Println("Counter of votes outside of voting window was not incremented, error:", err)
+	}
+
+	reply := s.event.OutsideReply
+	if reply == "" {
+		reply = defaultOutsideReply
+	}
+	s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, reply)
+}
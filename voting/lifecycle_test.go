@@ -0,0 +1,274 @@
+package voting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bilinguliar/gokiezen/score"
+)
+
+// lifecycleStorage keeps lifecycle state in memory.
+func lifecycleStorage(state string, scores map[string]int) *SkoreKprMock {
+	var frozen string
+
+	return &SkoreKprMock{
+		GetStateFunc: func() (string, error) {
+			return state, nil
+		},
+		SetStateFunc: func(s string) error {
+			state = s
+			return nil
+		},
+		FreezeResultsFunc: func(data string) error {
+			frozen = data
+			return nil
+		},
+		GetFrozenResultsFunc: func() (string, error) {
+			return frozen, nil
+		},
+		GetAllCandidatesFunc: func() ([]string, error) {
+			return []string{"ABBA"}, nil
+		},
+		GetAllCountriesFunc: func() ([]string, error) {
+			return nil, nil
+		},
+		GetAllOperatorsFunc: func() ([]string, error) {
+			return nil, nil
+		},
+		GetAllTypesFunc: func() ([]string, error) {
+			return nil, nil
+		},
+		GetCandidateScoresFunc: func(names []string) (map[string]int, error) {
+			result := make(map[string]int)
+			for _, n := range names {
+				result[n] = scores[n]
+			}
+			return result, nil
+		},
+		GetInvalidVotesFunc: func() (int, error) {
+			return 0, nil
+		},
+		GetRejectedVotesFunc: func() (int, error) {
+			return 0, nil
+		},
+		AddEarlyVoteFunc: func() error {
+			scores["early"]++
+			return nil
+		},
+		GetEarlyVotesFunc: func() (int, error) {
+			return scores["early"], nil
+		},
+		AddLateVoteFunc: func() error {
+			scores["late"]++
+			return nil
+		},
+		GetLateVotesFunc: func() (int, error) {
+			return scores["late"], nil
+		},
+		GetDeliveryFunc: func() (map[string]int, error) {
+			return nil, nil
+		},
+	}
+}
+
+func TestStateFollowsSchedule(t *testing.T) {
+	start := time.Date(2017, 5, 13, 19, 0, 0, 0, time.UTC)
+
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		lifecycleStorage("", map[string]int{}),
+		NewBus(),
+		Event{OpensAt: start, ClosesAt: start.Add(time.Hour)},
+	)
+
+	cases := []struct {
+		now      time.Time
+		expected State
+	}{
+		{start.Add(-time.Minute), Draft},
+		{start, Open},
+		{start.Add(30 * time.Minute), Open},
+		{start.Add(time.Hour), Closed},
+	}
+
+	for _, c := range cases {
+		svc.now = func() time.Time { return c.now }
+
+		state, err := svc.State()
+		if err != nil {
+			t.Error("Unexpected error:", err)
+		}
+
+		if state != c.expected {
+			t.Errorf("State at %v is %q, expected %q", c.now, state, c.expected)
+		}
+	}
+
+	if err := svc.Open(); err != ErrInvalidTransition {
+		t.Error("Event past its closing time was opened.")
+	}
+}
+
+func TestCloseFreezesResults(t *testing.T) {
+	scores := map[string]int{"ABBA": 5}
+
+	svc := New(&MessengerMock{}, &EnquirerMock{}, lifecycleStorage(string(Open), scores), NewBus(), Event{})
+
+	if err := svc.Close(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	scores["ABBA"] = 10
+
+	stats, err := svc.GetStats()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if stats.State != Closed {
+		t.Errorf("State is %q, expected %q", stats.State, Closed)
+	}
+
+	if stats.Candidates[0].Value != 5 {
+		t.Errorf("Score for ABBA is %d, expected frozen %d", stats.Candidates[0].Value, 5)
+	}
+}
+
+func TestVotesOutsideOfWindowAreCountedSeparately(t *testing.T) {
+	var (
+		scores = map[string]int{}
+		reply  string
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{},
+		lifecycleStorage("", scores),
+		NewBus(),
+		Event{OutsideReply: "Lines are closed."},
+	)
+
+	if err := svc.RegisterVote("380661234567", "ABBA"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if err := svc.Close(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if err := svc.RegisterVote("380661234567", "ABBA"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if scores["early"] != 1 || scores["late"] != 1 {
+		t.Errorf("Early votes: %d, late votes: %d, expected one of each", scores["early"], scores["late"])
+	}
+
+	if reply != "Lines are closed." {
+		t.Errorf("Reply is %q, expected configured one", reply)
+	}
+}
+
+func TestVoteIsNotCountedIfEventClosedMeanwhile(t *testing.T) {
+	var (
+		scores = map[string]int{}
+		reply  string
+	)
+
+	storage := lifecycleStorage(string(Open), scores)
+	storage.IsCandidateFunc = func(name string) (bool, error) {
+		return true, nil
+	}
+	// Event was closed by another request after this one checked the state.
+	storage.RecordVoteFunc = func(v score.Vote) (string, error) {
+		return score.VoteClosed, nil
+	}
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{}, nil
+			},
+		},
+		storage,
+		NewBus(),
+		Event{OutsideReply: "Lines are closed."},
+	)
+
+	if err := svc.RegisterVote("380661234567", "ABBA"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if scores["late"] != 1 {
+		t.Errorf("Late votes: %d, expected %d", scores["late"], 1)
+	}
+
+	if reply != "Lines are closed." {
+		t.Errorf("Reply is %q, expected configured one", reply)
+	}
+}
+
+func TestArchiveRequiresClosedEvent(t *testing.T) {
+	svc := New(&MessengerMock{}, &EnquirerMock{}, lifecycleStorage(string(Open), map[string]int{}), NewBus(), Event{})
+
+	if err := svc.Archive(); err != ErrInvalidTransition {
+		t.Error("Open event was archived.")
+	}
+
+	if err := svc.Close(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if err := svc.Archive(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if err := svc.Open(); err != ErrInvalidTransition {
+		t.Error("Archived event was opened.")
+	}
+}
+
+func TestEventPastItsClosingTimeIsAddedButNotOpened(t *testing.T) {
+	events := NewEvents(
+		&EventStoreMock{
+			SaveEventFunc: func(id, data string) error {
+				return nil
+			},
+		},
+		&MessengerMock{},
+		&EnquirerMock{},
+		NewBus(),
+		func(id string) Storage {
+			return StorageMock{lifecycleStorage("", map[string]int{}), &MockedRegistry{}}
+		},
+	)
+
+	// Default event is restarted after its voting window, opening time is not set.
+	err := events.Add(Event{ID: "eurovision", ClosesAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	votes, _, ok := events.Get("eurovision")
+	if !ok {
+		t.Fatal("Event was not added.")
+	}
+
+	if err = votes.Open(); err != ErrInvalidTransition {
+		t.Errorf("Error: %v, expected %v", err, ErrInvalidTransition)
+	}
+
+	if state, _ := votes.State(); state != Draft {
+		t.Errorf("State is %q, expected %q", state, Draft)
+	}
+}
@@ -0,0 +1,150 @@
+package voting
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// minFuzzyLen is a length of normalized name starting from which typos are tolerated.
+// Short codes like "1" or "A" must always be matched exactly.
+const minFuzzyLen = 3
+
+// Matcher resolves free form SMS text to one of registered candidates.
+// Text is compared ignoring case, diacritics, punctuation and spaces.
+// Near misses are resolved by edit distance if it does not exceed configured threshold.
+type Matcher struct {
+	maxDistance int
+}
+
+// NewMatcher creates Matcher that tolerates up to maxDistance typos in candidate name.
+func NewMatcher(maxDistance int) *Matcher {
+	return &Matcher{maxDistance: maxDistance}
+}
+
+// Match finds candidate that text refers to. Aliases map alias or short code to candidate name.
+// Returns resolved candidate name. If text is equally close to several candidates,
+// name is empty and all of them are returned as options, so voter can be asked to clarify.
+// Both results are empty if nothing matched.
+func (m *Matcher) Match(text string, candidates []string, aliases map[string]string) (string, []string) {
+	n := normalize(text)
+	if n == "" {
+		return "", nil
+	}
+
+	// Every candidate name is an alias for itself.
+	names := make(map[string]string, len(candidates)+len(aliases))
+	registered := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		registered[c] = true
+		names[normalize(c)] = c
+	}
+	for a, c := range aliases {
+		// Alias can outlive deleted candidate.
+		if !registered[c] {
+			continue
+		}
+		if _, ok := names[normalize(a)]; !ok {
+			names[normalize(a)] = c
+		}
+	}
+
+	if c, ok := names[n]; ok {
+		return c, nil
+	}
+
+	best := m.maxDistance + 1
+	closest := make(map[string]bool)
+
+	for name, c := range names {
+		if len([]rune(name)) < minFuzzyLen {
+			continue
+		}
+
+		d := distance(n, name)
+		switch {
+		case d > m.maxDistance:
+			continue
+		case d < best:
+			best = d
+			closest = map[string]bool{c: true}
+		case d == best:
+			closest[c] = true
+		}
+	}
+
+	switch len(closest) {
+	case 0:
+		return "", nil
+	case 1:
+		for c := range closest {
+			return c, nil
+		}
+	}
+
+	options := make([]string, 0, len(closest))
+	for c := range closest {
+		options = append(options, c)
+	}
+	sort.Strings(options)
+
+	return "", options
+}
+
+// normalize brings text to canonical form: no diacritics, lower case, only letters and digits.
+func normalize(text string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, err := transform.String(t, text)
+	if err != nil {
+		s = text
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// distance calculates Levenshtein distance between two strings.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// min3 returns the smallest of three integers.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
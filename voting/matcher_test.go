@@ -0,0 +1,70 @@
+package voting
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	candidates := []string{"ABBA", "Lordi", "Måneskin", "Gigliola Cinquetti"}
+	aliases := map[string]string{
+		"1":      "ABBA",
+		"A":      "ABBA",
+		"2":      "Lordi",
+		"Queen":  "Freddie", // Not registered candidate.
+		"Gigi C": "Gigliola Cinquetti",
+	}
+
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"ABBA", "ABBA"},
+		{"abba", "ABBA"},
+		{"ABBA!", "ABBA"},
+		{" Abba ", "ABBA"},
+		{"ABA", "ABBA"},
+		{"1", "ABBA"},
+		{"a", "ABBA"},
+		{"2", "Lordi"},
+		{"maneskin", "Måneskin"},
+		{"MANESKIN!!!", "Måneskin"},
+		{"gigliola cinquetti", "Gigliola Cinquetti"},
+		{"GigliolaCinqueti", "Gigliola Cinquetti"},
+		{"gigi-c", "Gigliola Cinquetti"},
+		{"Queen", ""},
+		{"3", ""},
+		{"Celine Dion", ""},
+		{"!!!", ""},
+	}
+
+	m := NewMatcher(2)
+
+	for _, c := range cases {
+		cand, _ := m.Match(c.text, candidates, aliases)
+		if cand != c.expected {
+			t.Errorf("Text %q matched %q, expected %q", c.text, cand, c.expected)
+		}
+	}
+}
+
+func TestMatchReturnsOptionsWhenAmbiguous(t *testing.T) {
+	m := NewMatcher(1)
+
+	cand, options := m.Match("Lna", []string{"Lina", "Lena", "Lordi"}, nil)
+	if cand != "" {
+		t.Errorf("Matched %q, expected no match", cand)
+	}
+
+	expected := []string{"Lena", "Lina"}
+	if !reflect.DeepEqual(options, expected) {
+		t.Errorf("Options are %v, expected %v", options, expected)
+	}
+}
+
+func TestMatchRespectsThreshold(t *testing.T) {
+	cand, _ := NewMatcher(0).Match("ABA", []string{"ABBA"}, nil)
+	if cand != "" {
+		t.Errorf("Matched %q, expected exact match only", cand)
+	}
+}
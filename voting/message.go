@@ -0,0 +1,21 @@
+package voting
+
+import (
+	"net/http"
+	"time"
+)
+
+// Message is inbound SMS that was sent to one of our numbers.
+type Message struct {
+	ID         string    // Assigned by SMS service, the same message can be delivered more than once.
+	Originator string    // MSISDN of the voter.
+	Recipient  string    // Number (VMN) message was sent to.
+	Keyword    string    // Keyword message was matched by on a shared number, if any.
+	Body       string    // Full text of the message.
+	Created    time.Time // When SMS service received the message, zero if unknown.
+}
+
+// InboundParser reads inbound SMS from web-hook request. Every SMS service has its own format.
+type InboundParser interface {
+	ParseInbound(req *http.Request) (Message, error)
+}
@@ -0,0 +1,320 @@
+package voting
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoCountryScores is returned when results can not be calculated, because scores of candidates
+	// within countries could not be read or were not kept when event was closed.
+	ErrNoCountryScores = errors.New("scores within countries are not available")
+	// ErrInvalidScoring is returned when scoring rules can not be parsed.
+	ErrInvalidScoring = errors.New("invalid scoring rules")
+)
+
+// DefaultPoints are points that each country gives to its top ten candidates, Eurovision style.
+var DefaultPoints = []int{12, 10, 8, 7, 6, 5, 4, 3, 2, 1}
+
+// Scoring configures how votes are turned into points. Televote of each country is ranked,
+// candidates ranked first, second and so on get points from the table. Jury of a country ranks candidates
+// the same way and its points are added on top. Country codes are the ones lookup resolves voters to.
+//
+// Candidates with the same number of votes within a country are ranked by jury of that country,
+// then by their votes in all countries and then by name, so the same stats always give the same points.
+type Scoring struct {
+	Points      []int               // Points by place within a country, DefaultPoints if empty.
+	ExcludeSelf bool                // Country does not give points to its own candidates. Requires Origins.
+	Origins     map[string]string   // Country code of each candidate, needed to exclude self votes.
+	Jury        map[string][]string // Optional. Candidates ranked by jury of each country, the best first.
+}
+
+// Standing is a place of candidate on the leaderboard.
+type Standing struct {
+	Place    int // Candidates with the same points share the place.
+	Name     string
+	Points   int // Score under counting method. Televote and jury points together for points method.
+	Televote int // Points from televote.
+	Jury     int // Points from juries.
+	Votes    int // Raw number of votes or first preferences, it does not decide the place.
+}
+
+// Results is the leaderboard of event.
+type Results struct {
+	State     State
+	Method    string
+	Standings []Standing
+	Rounds    []Round `json:",omitempty"` // Elimination rounds of instant-runoff.
+}
+
+// Validate returns ErrInvalidScoring if scoring rules are inconsistent.
+func (sc Scoring) Validate() error {
+	if !sc.valid() {
+		return ErrInvalidScoring
+	}
+
+	return nil
+}
+
+// valid checks that points go down with place, jury does not rank candidate twice
+// and countries of candidates are known if self votes are excluded.
+func (sc Scoring) valid() bool {
+	if sc.ExcludeSelf && len(sc.Origins) == 0 {
+		return false
+	}
+
+	for i, p := range sc.Points {
+		if p <= 0 || i > 0 && p > sc.Points[i-1] {
+			return false
+		}
+	}
+
+	for _, ranking := range sc.Jury {
+		seen := make(map[string]bool, len(ranking))
+		for _, name := range ranking {
+			if seen[name] {
+				return false
+			}
+			seen[name] = true
+		}
+	}
+
+	return true
+}
+
+// points returns points table of the event.
+func (sc Scoring) points() []int {
+	if len(sc.Points) == 0 {
+		return DefaultPoints
+	}
+
+	return sc.Points
+}
+
+// Leaderboard turns stats into standings of all candidates. Candidates are ordered by total points,
+// ties are broken by televote points, like Eurovision does. Candidates with the same total and televote points
+// share the place and are listed by name. Votes of unresolved country give no points.
+func (sc Scoring) Leaderboard(stats Stats) []Standing {
+	standings := make(map[string]*Standing, len(stats.Candidates))
+	for _, c := range stats.Candidates {
+		standings[c.Name] = &Standing{Name: c.Name, Votes: c.Value}
+	}
+
+	for country, items := range stats.ByCountry {
+		if country == unresolved {
+			continue
+		}
+
+		scores := make(map[string]int, len(items))
+		for _, it := range items {
+			if it.Value > 0 && sc.eligible(standings, country, it.Name) {
+				scores[it.Name] = it.Value
+			}
+		}
+
+		sc.award(sc.rankTelevote(country, scores, standings), func(st *Standing, p int) { st.Televote += p }, standings)
+	}
+
+	for country, ranking := range sc.Jury {
+		items := make([]StatItem, 0, len(ranking))
+		for _, name := range ranking {
+			if sc.eligible(standings, country, name) {
+				items = append(items, StatItem{Name: name})
+			}
+		}
+
+		sc.award(items, func(st *Standing, p int) { st.Jury += p }, standings)
+	}
+
+	for _, st := range standings {
+		st.Points = st.Televote + st.Jury
+	}
+
+	return rankStandings(standings)
+}
+
+// eligible checks if country can give points to the candidate.
+func (sc Scoring) eligible(standings map[string]*Standing, country, name string) bool {
+	if _, ok := standings[name]; !ok {
+		return false
+	}
+
+	return !sc.ExcludeSelf || sc.Origins[name] != country
+}
+
+// rankTelevote orders candidates by votes within country. Ties are broken by jury of the same country,
+// candidate it did not rank goes after those it did, then by votes in all countries and then by name.
+func (sc Scoring) rankTelevote(country string, scores map[string]int, standings map[string]*Standing) []StatItem {
+	ranking := sc.Jury[country]
+	juryPlace := func(name string) int {
+		for i, ranked := range ranking {
+			if ranked == name {
+				return i
+			}
+		}
+		return len(ranking)
+	}
+
+	items := make([]StatItem, 0, len(scores))
+	for name, v := range scores {
+		items = append(items, StatItem{Name: name, Value: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if pa, pb := juryPlace(a.Name), juryPlace(b.Name); pa != pb {
+			return pa < pb
+		}
+		if va, vb := standings[a.Name].Votes, standings[b.Name].Votes; va != vb {
+			return va > vb
+		}
+		return a.Name < b.Name
+	})
+
+	return items
+}
+
+// award gives points of the table to ranked candidates, the rest get nothing.
+func (sc Scoring) award(ranked []StatItem, add func(st *Standing, points int), standings map[string]*Standing) {
+	table := sc.points()
+
+	for i, it := range ranked {
+		if i >= len(table) {
+			return
+		}
+		add(standings[it.Name], table[i])
+	}
+}
+
+// rankStandings orders standings by points and assigns places. Ties are broken by televote points.
+func rankStandings(standings map[string]*Standing) []Standing {
+	list := make([]Standing, 0, len(standings))
+	for _, st := range standings {
+		list = append(list, *st)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Televote != b.Televote {
+			return a.Televote > b.Televote
+		}
+		return a.Name < b.Name
+	})
+
+	for i := range list {
+		list[i].Place = i + 1
+		if i > 0 && list[i].Points == list[i-1].Points && list[i].Televote == list[i-1].Televote {
+			list[i].Place = list[i-1].Place
+		}
+	}
+
+	return list
+}
+
+// GetResults returns the leaderboard calculated with given method, points by scoring rules of the event if it is empty.
+// Points of closed event are based on stats frozen at the moment of closing.
+func (s *Voting) GetResults(method string) (Results, error) {
+	if method != "" && method != MethodPoints {
+		return s.tally(method)
+	}
+
+	stats, err := s.GetStats()
+	if err != nil {
+		log.Println("Failed to get stats for results, error:", err)
+		return Results{}, err
+	}
+
+	if stats.ByCountry == nil && len(stats.Countries) > 0 {
+		return Results{}, ErrNoCountryScores
+	}
+
+	return Results{State: stats.State, Method: MethodPoints, Standings: s.event.Scoring.Leaderboard(stats)}, nil
+}
+
+// ParsePoints parses comma separated points table, the highest points first. Empty table means DefaultPoints.
+func ParsePoints(spec string) ([]int, error) {
+	var points []int
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		p, err := strconv.Atoi(entry)
+		if err != nil {
+			return nil, ErrInvalidScoring
+		}
+		points = append(points, p)
+	}
+
+	if !(Scoring{Points: points}).valid() {
+		return nil, ErrInvalidScoring
+	}
+
+	return points, nil
+}
+
+// ParseOrigins parses comma separated list of "candidate=country" pairs.
+func ParseOrigins(spec string) (map[string]string, error) {
+	origins := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, ErrInvalidScoring
+		}
+
+		origins[strings.TrimSpace(parts[0])] = strings.ToUpper(strings.TrimSpace(parts[1]))
+	}
+
+	return origins, nil
+}
+
+// ParseJury parses comma separated rankings of juries in "country=first|second|third" format.
+func ParseJury(spec string) (map[string][]string, error) {
+	jury := make(map[string][]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		country := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || country == "" {
+			return nil, ErrInvalidScoring
+		}
+
+		var ranking []string
+		for _, name := range strings.Split(parts[1], "|") {
+			if name = strings.TrimSpace(name); name == "" {
+				return nil, ErrInvalidScoring
+			}
+			ranking = append(ranking, name)
+		}
+
+		jury[country] = ranking
+	}
+
+	if !(Scoring{Jury: jury}).valid() {
+		return nil, ErrInvalidScoring
+	}
+
+	return jury, nil
+}
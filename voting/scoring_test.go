@@ -0,0 +1,133 @@
+package voting
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLeaderboard(t *testing.T) {
+	stats := Stats{
+		Candidates: []StatItem{{"ABBA", 60}, {"Lordi", 45}, {"Loreen", 30}, {"Ruslana", 0}},
+		ByCountry: map[string][]StatItem{
+			"SE":       {{"ABBA", 40}, {"Loreen", 20}, {"Lordi", 5}},
+			"FI":       {{"Lordi", 30}, {"ABBA", 10}, {"Loreen", 10}},
+			"NL":       {{"ABBA", 10}, {"Lordi", 10}},
+			unresolved: {{"Ruslana", 100}},
+		},
+	}
+
+	scoring := Scoring{
+		Points:      []int{3, 2, 1},
+		ExcludeSelf: true,
+		Origins:     map[string]string{"ABBA": "SE", "Loreen": "SE", "Lordi": "FI"},
+		Jury:        map[string][]string{"SE": {"ABBA", "Lordi", "Ruslana"}, "UA": {"Ruslana", "Unknown", "Lordi"}},
+	}
+
+	// SE televote: Lordi 3. FI televote: ABBA 3, Loreen 2 (tie broken by total votes). NL televote: ABBA 3, Lordi 2.
+	// SE jury: Lordi 3, Ruslana 2. UA jury: Ruslana 3, Lordi 2.
+	expected := []Standing{
+		{Place: 1, Name: "Lordi", Points: 10, Televote: 5, Jury: 5, Votes: 45},
+		{Place: 2, Name: "ABBA", Points: 6, Televote: 6, Votes: 60},
+		{Place: 3, Name: "Ruslana", Points: 5, Jury: 5, Votes: 0},
+		{Place: 4, Name: "Loreen", Points: 2, Televote: 2, Votes: 30},
+	}
+
+	if standings := scoring.Leaderboard(stats); !reflect.DeepEqual(standings, expected) {
+		t.Errorf("Standings: %+v, expected %+v", standings, expected)
+	}
+}
+
+func TestLeaderboardSharesPlaces(t *testing.T) {
+	stats := Stats{
+		Candidates: []StatItem{{"ABBA", 1}, {"Lordi", 1}, {"Loreen", 0}},
+		ByCountry: map[string][]StatItem{
+			"SE": {{"Lordi", 1}},
+			"FI": {{"ABBA", 1}},
+		},
+	}
+
+	standings := Scoring{}.Leaderboard(stats)
+
+	places := make(map[string]int)
+	for _, st := range standings {
+		places[st.Name] = st.Place
+	}
+
+	expected := map[string]int{"ABBA": 1, "Lordi": 1, "Loreen": 3}
+	if !reflect.DeepEqual(places, expected) {
+		t.Errorf("Places: %v, expected %v", places, expected)
+	}
+
+	if standings[0].Points != DefaultPoints[0] {
+		t.Errorf("Points: %d, expected %d from default table", standings[0].Points, DefaultPoints[0])
+	}
+}
+
+func TestLeaderboardBreaksTelevoteTies(t *testing.T) {
+	stats := Stats{
+		Candidates: []StatItem{{"ABBA", 3}, {"Lordi", 5}, {"Loreen", 3}, {"Ruslana", 3}},
+		ByCountry: map[string][]StatItem{
+			"SE":       {{"ABBA", 2}, {"Loreen", 2}},
+			"FI":       {{"Loreen", 1}, {"Lordi", 1}},
+			"NL":       {{"Ruslana", 1}, {"ABBA", 1}},
+			unresolved: {{"Lordi", 4}, {"Ruslana", 2}},
+		},
+	}
+
+	scoring := Scoring{Points: []int{2, 1}, Jury: map[string][]string{"SE": {"Loreen", "ABBA"}}}
+
+	// SE televote: Loreen 2, ABBA 1 (tie broken by SE jury). FI televote: Lordi 2, Loreen 1 (tie broken by total votes).
+	// NL televote: ABBA 2, Ruslana 1 (tie of total votes broken by name). SE jury: Loreen 2, ABBA 1.
+	expected := []Standing{
+		{Place: 1, Name: "Loreen", Points: 5, Televote: 3, Jury: 2, Votes: 3},
+		{Place: 2, Name: "ABBA", Points: 4, Televote: 3, Jury: 1, Votes: 3},
+		{Place: 3, Name: "Lordi", Points: 2, Televote: 2, Votes: 5},
+		{Place: 4, Name: "Ruslana", Points: 1, Televote: 1, Votes: 3},
+	}
+
+	if standings := scoring.Leaderboard(stats); !reflect.DeepEqual(standings, expected) {
+		t.Errorf("Standings: %+v, expected %+v", standings, expected)
+	}
+}
+
+func TestParseScoring(t *testing.T) {
+	if points, err := ParsePoints("5, 3,1"); err != nil || !reflect.DeepEqual(points, []int{5, 3, 1}) {
+		t.Errorf("Points: %v, error: %v", points, err)
+	}
+
+	origins, err := ParseOrigins("ABBA=se, Lordi = FI")
+	if expected := map[string]string{"ABBA": "SE", "Lordi": "FI"}; err != nil || !reflect.DeepEqual(origins, expected) {
+		t.Errorf("Origins: %v, error: %v, expected %v", origins, err, expected)
+	}
+
+	jury, err := ParseJury("se=Lordi|ABBA, FI=ABBA")
+	if expected := map[string][]string{"SE": {"Lordi", "ABBA"}, "FI": {"ABBA"}}; err != nil || !reflect.DeepEqual(jury, expected) {
+		t.Errorf("Jury: %v, error: %v, expected %v", jury, err, expected)
+	}
+
+	for _, spec := range []string{"12,x", "1,2", "0"} {
+		if _, err = ParsePoints(spec); err != ErrInvalidScoring {
+			t.Errorf("Points %q: error %v, expected %v", spec, err, ErrInvalidScoring)
+		}
+	}
+
+	for _, spec := range []string{"ABBA", "=SE", "ABBA="} {
+		if _, err = ParseOrigins(spec); err != ErrInvalidScoring {
+			t.Errorf("Origins %q: error %v, expected %v", spec, err, ErrInvalidScoring)
+		}
+	}
+
+	for _, spec := range []string{"SE", "SE=ABBA||Lordi", "SE=ABBA|ABBA"} {
+		if _, err = ParseJury(spec); err != ErrInvalidScoring {
+			t.Errorf("Jury %q: error %v, expected %v", spec, err, ErrInvalidScoring)
+		}
+	}
+
+	if err = (Scoring{ExcludeSelf: true}).Validate(); err != ErrInvalidScoring {
+		t.Errorf("Self votes excluded without countries of candidates: error %v, expected %v", err, ErrInvalidScoring)
+	}
+
+	if err = (Scoring{ExcludeSelf: true, Origins: origins}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package voting
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Methods of counting results. Points are given by countries, see Scoring, the rest are calculated from ballots.
+const (
+	MethodPoints    = "points"
+	MethodPlurality = "plurality"
+	MethodApproval  = "approval"
+	MethodBorda     = "borda"
+	MethodIRV       = "irv"
+)
+
+// ErrUnknownMethod is returned when results are requested for unsupported counting method.
+var ErrUnknownMethod = errors.New("unknown counting method")
+
+// Tallier calculates results from ballots. Ballots hold only registered candidates, each of them at most once.
+type Tallier interface {
+	Tally(candidates []string, ballots []Ballot) Results
+}
+
+var talliers = map[string]Tallier{
+	MethodPlurality: Plurality{},
+	MethodApproval:  Approval{},
+	MethodBorda:     Borda{},
+	MethodIRV:       InstantRunoff{},
+}
+
+// tallyTTL limits how often ballots of open event are read, every tally reads all of them.
+const tallyTTL = 10 * time.Second
+
+// tallies caches results of every counting method. Results of closed event do not change, they are kept until
+// event is opened again or candidates change. Lock is held while ballots are counted, so concurrent requests wait for the same tally.
+type tallies struct {
+	mu      sync.Mutex
+	results map[string]tallied
+}
+
+type tallied struct {
+	results    Results
+	candidates string // Sorted candidates the results were counted for.
+	at         time.Time
+}
+
+// Round is a single round of instant-runoff count.
+type Round struct {
+	Number     int
+	Counts     []StatItem // Votes of candidates that are still in the race, the most voted first.
+	Exhausted  int        // Ballots that rank none of the candidates still in the race.
+	Eliminated []string   // Candidates eliminated after this round.
+	Elected    string     // Winner, it is set in the last round only.
+}
+
+// Plurality counts first preferences only, the same way votes are counted in stats.
+type Plurality struct{}
+
+// Tally gives a point to the first choice of every ballot.
+func (Plurality) Tally(candidates []string, ballots []Ballot) Results {
+	votes := firstChoices(ballots)
+	return Results{Standings: rankByPoints(candidates, votes, votes)}
+}
+
+// Approval gives a point to every candidate named on the ballot, order of preferences does not matter.
+type Approval struct{}
+
+// Tally counts ballots that name each candidate.
+func (Approval) Tally(candidates []string, ballots []Ballot) Results {
+	points := make(map[string]int)
+	for _, b := range ballots {
+		for _, name := range b {
+			points[name]++
+		}
+	}
+
+	return Results{Standings: rankByPoints(candidates, points, firstChoices(ballots))}
+}
+
+// Borda gives n-1 points to the first choice, n-2 to the second and so on, n is number of candidates.
+// Candidates that are not ranked on the ballot get nothing from it.
+type Borda struct{}
+
+// Tally sums points of all ballots.
+func (Borda) Tally(candidates []string, ballots []Ballot) Results {
+	points := make(map[string]int)
+	for _, b := range ballots {
+		for i, name := range b {
+			points[name] += len(candidates) - 1 - i
+		}
+	}
+
+	return Results{Standings: rankByPoints(candidates, points, firstChoices(ballots))}
+}
+
+// InstantRunoff counts first preferences and eliminates the least voted candidate until one of them
+// has majority of ballots that still rank someone in the race. Votes of eliminated candidate go to the next
+// preference on the ballot. Candidates without votes are eliminated together, other ties are broken by name.
+type InstantRunoff struct{}
+
+// Tally runs elimination rounds, all of them are returned together with standings. Winner is placed first,
+// others are placed by the round they were eliminated in. Points are votes in the last round candidate took part in.
+func (InstantRunoff) Tally(candidates []string, ballots []Ballot) Results {
+	active := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		active[c] = true
+	}
+
+	var (
+		rounds     []Round
+		eliminated [][]string
+		last       = make(map[string]int, len(candidates))
+	)
+
+	for len(active) > 0 {
+		counts := make(map[string]int, len(active))
+		for c := range active {
+			counts[c] = 0
+		}
+
+		exhausted := 0
+		for _, b := range ballots {
+			if name, ok := firstActive(b, active); ok {
+				counts[name]++
+			} else {
+				exhausted++
+			}
+		}
+
+		for c, v := range counts {
+			last[c] = v
+		}
+
+		r := Round{Number: len(rounds) + 1, Counts: rankItems(counts), Exhausted: exhausted}
+		continuing := len(ballots) - exhausted
+
+		if continuing == 0 {
+			rounds = append(rounds, r)
+			break
+		}
+
+		if top := r.Counts[0]; top.Value*2 > continuing || len(active) == 1 {
+			r.Elected = top.Name
+			rounds = append(rounds, r)
+			break
+		}
+
+		r.Eliminated = losers(r.Counts)
+		for _, name := range r.Eliminated {
+			delete(active, name)
+		}
+
+		eliminated = append(eliminated, r.Eliminated)
+		rounds = append(rounds, r)
+	}
+
+	return Results{Standings: runoffStandings(rounds, eliminated, last, firstChoices(ballots)), Rounds: rounds}
+}
+
+// losers returns candidates to eliminate after the round: all of them without votes or the least voted one.
+func losers(ranked []StatItem) []string {
+	lowest := ranked[len(ranked)-1]
+	if lowest.Value > 0 {
+		return []string{lowest.Name}
+	}
+
+	var names []string
+	for _, it := range ranked {
+		if it.Value == 0 {
+			names = append(names, it.Name)
+		}
+	}
+
+	return names
+}
+
+// runoffStandings places candidates of the last round by their votes, then eliminated ones, the last eliminated first.
+func runoffStandings(rounds []Round, eliminated [][]string, last, votes map[string]int) []Standing {
+	var (
+		list   []Standing
+		shares []bool // Standing shares the place with the previous one.
+	)
+
+	if len(rounds) > 0 {
+		for i, it := range rounds[len(rounds)-1].Counts {
+			list = append(list, Standing{Name: it.Name, Points: it.Value, Votes: votes[it.Name]})
+			shares = append(shares, i > 0 && it.Value == list[i-1].Points)
+		}
+	}
+
+	for i := len(eliminated) - 1; i >= 0; i-- {
+		group := append([]string(nil), eliminated[i]...)
+		sort.Strings(group)
+
+		for j, name := range group {
+			list = append(list, Standing{Name: name, Points: last[name], Votes: votes[name]})
+			shares = append(shares, j > 0)
+		}
+	}
+
+	for i := range list {
+		list[i].Place = i + 1
+		if shares[i] {
+			list[i].Place = list[i-1].Place
+		}
+	}
+
+	return list
+}
+
+// firstActive returns the most preferred candidate on the ballot that is still in the race.
+func firstActive(b Ballot, active map[string]bool) (string, bool) {
+	for _, name := range b {
+		if active[name] {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// firstChoices counts first preferences of ballots.
+func firstChoices(ballots []Ballot) map[string]int {
+	votes := make(map[string]int)
+	for _, b := range ballots {
+		if len(b) > 0 {
+			votes[b[0]]++
+		}
+	}
+
+	return votes
+}
+
+// rankByPoints returns standings of all candidates ordered by points. Candidates with the same points share the place.
+func rankByPoints(candidates []string, points, votes map[string]int) []Standing {
+	standings := make(map[string]*Standing, len(candidates))
+	for _, c := range candidates {
+		standings[c] = &Standing{Name: c, Points: points[c], Votes: votes[c]}
+	}
+
+	return rankStandings(standings)
+}
+
+// cleanBallots drops candidates that are not registered anymore and repeated preferences.
+// Ballots left without candidates are dropped.
+func cleanBallots(candidates []string, ballots []Ballot) []Ballot {
+	registered := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		registered[c] = true
+	}
+
+	clean := make([]Ballot, 0, len(ballots))
+	for _, b := range ballots {
+		var (
+			cb   Ballot
+			seen = make(map[string]bool, len(b))
+		)
+
+		for _, name := range b {
+			if registered[name] && !seen[name] {
+				seen[name] = true
+				cb = append(cb, name)
+			}
+		}
+
+		if len(cb) > 0 {
+			clean = append(clean, cb)
+		}
+	}
+
+	return clean
+}
+
+// tally calculates results with given method from stored ballots. Ballots do not change after event is closed,
+// votes that come later are not counted, so they are read as they are.
+func (s *Voting) tally(method string) (Results, error) {
+	t, ok := talliers[method]
+	if !ok {
+		return Results{}, ErrUnknownMethod
+	}
+
+	state, err := s.State()
+	if err != nil {
+		return Results{}, err
+	}
+
+	candidates, err := s.scoreKpr.GetAllCandidates()
+	if err != nil {
+		log.Println("Failed to retrieve set of all candidates, error:", err)
+		return Results{}, err
+	}
+
+	sort.Strings(candidates)
+	names := strings.Join(candidates, "\n")
+
+	s.tallies.mu.Lock()
+	defer s.tallies.mu.Unlock()
+
+	now := s.now()
+
+	if c, ok := s.tallies.results[method]; ok && c.results.State == state && c.candidates == names {
+		if state == Closed || state == Archived || now.Sub(c.at) < tallyTTL {
+			return c.results, nil
+		}
+	}
+
+	data, err := s.scoreKpr.GetBallots()
+	if err != nil {
+		log.Println("Failed to read ballots, error:", err)
+		return Results{}, err
+	}
+
+	results := t.Tally(candidates, cleanBallots(candidates, decodeBallots(data)))
+	results.State, results.Method = state, method
+
+	if s.tallies.results == nil {
+		s.tallies.results = make(map[string]tallied)
+	}
+	s.tallies.results[method] = tallied{results: results, candidates: names, at: now}
+
+	return results, nil
+}
@@ -0,0 +1,212 @@
+package voting
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	tallyCandidates = []string{"ABBA", "Lordi", "Loreen", "Ruslana"}
+	tallyBallots    = repeatBallots(
+		4, Ballot{"ABBA", "Lordi", "Loreen"},
+		3, Ballot{"Lordi", "Loreen"},
+		2, Ballot{"Loreen", "Lordi"},
+	)
+)
+
+func repeatBallots(args ...interface{}) []Ballot {
+	var ballots []Ballot
+	for i := 0; i < len(args); i += 2 {
+		for n := 0; n < args[i].(int); n++ {
+			ballots = append(ballots, args[i+1].(Ballot))
+		}
+	}
+
+	return ballots
+}
+
+func TestTally(t *testing.T) {
+	tests := []struct {
+		tallier  Tallier
+		expected []Standing
+	}{
+		{
+			Plurality{},
+			[]Standing{
+				{Place: 1, Name: "ABBA", Points: 4, Votes: 4},
+				{Place: 2, Name: "Lordi", Points: 3, Votes: 3},
+				{Place: 3, Name: "Loreen", Points: 2, Votes: 2},
+				{Place: 4, Name: "Ruslana"},
+			},
+		},
+		{
+			Approval{},
+			[]Standing{
+				{Place: 1, Name: "Lordi", Points: 9, Votes: 3},
+				{Place: 1, Name: "Loreen", Points: 9, Votes: 2},
+				{Place: 3, Name: "ABBA", Points: 4, Votes: 4},
+				{Place: 4, Name: "Ruslana"},
+			},
+		},
+		{
+			// First choice gets 3 points, second 2 and third 1.
+			Borda{},
+			[]Standing{
+				{Place: 1, Name: "Lordi", Points: 21, Votes: 3},
+				{Place: 2, Name: "Loreen", Points: 16, Votes: 2},
+				{Place: 3, Name: "ABBA", Points: 12, Votes: 4},
+				{Place: 4, Name: "Ruslana"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		results := test.tallier.Tally(tallyCandidates, tallyBallots)
+		if !reflect.DeepEqual(results.Standings, test.expected) {
+			t.Errorf("%T standings: %+v, expected %+v", test.tallier, results.Standings, test.expected)
+		}
+	}
+}
+
+func TestInstantRunoff(t *testing.T) {
+	results := InstantRunoff{}.Tally(tallyCandidates, tallyBallots)
+
+	// Ruslana has no votes, Loreen is the least voted then, her votes go to Lordi.
+	rounds := []Round{
+		{Number: 1, Counts: []StatItem{{"ABBA", 4}, {"Lordi", 3}, {"Loreen", 2}, {"Ruslana", 0}}, Eliminated: []string{"Ruslana"}},
+		{Number: 2, Counts: []StatItem{{"ABBA", 4}, {"Lordi", 3}, {"Loreen", 2}}, Eliminated: []string{"Loreen"}},
+		{Number: 3, Counts: []StatItem{{"Lordi", 5}, {"ABBA", 4}}, Elected: "Lordi"},
+	}
+
+	if !reflect.DeepEqual(results.Rounds, rounds) {
+		t.Errorf("Rounds: %+v, expected %+v", results.Rounds, rounds)
+	}
+
+	standings := []Standing{
+		{Place: 1, Name: "Lordi", Points: 5, Votes: 3},
+		{Place: 2, Name: "ABBA", Points: 4, Votes: 4},
+		{Place: 3, Name: "Loreen", Points: 2, Votes: 2},
+		{Place: 4, Name: "Ruslana"},
+	}
+
+	if !reflect.DeepEqual(results.Standings, standings) {
+		t.Errorf("Standings: %+v, expected %+v", results.Standings, standings)
+	}
+}
+
+func TestInstantRunoffCountsExhaustedBallots(t *testing.T) {
+	ballots := repeatBallots(2, Ballot{"ABBA"}, 2, Ballot{"Lordi"}, 1, Ballot{"Loreen"})
+
+	results := InstantRunoff{}.Tally([]string{"ABBA", "Lordi", "Loreen"}, ballots)
+
+	// Tie of ABBA and Lordi is broken by name, the last one in alphabet is eliminated.
+	rounds := []Round{
+		{Number: 1, Counts: []StatItem{{"ABBA", 2}, {"Lordi", 2}, {"Loreen", 1}}, Eliminated: []string{"Loreen"}},
+		{Number: 2, Counts: []StatItem{{"ABBA", 2}, {"Lordi", 2}}, Exhausted: 1, Eliminated: []string{"Lordi"}},
+		{Number: 3, Counts: []StatItem{{"ABBA", 2}}, Exhausted: 3, Elected: "ABBA"},
+	}
+
+	if !reflect.DeepEqual(results.Rounds, rounds) {
+		t.Errorf("Rounds: %+v, expected %+v", results.Rounds, rounds)
+	}
+}
+
+func TestGetResultsTalliesStoredBallots(t *testing.T) {
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return []string{"Lordi", "ABBA"}, nil
+			},
+			GetBallotsFunc: func() ([]string, error) {
+				// Removed candidate and repeated preference are dropped, broken ballot is skipped.
+				return []string{`["Verka","Lordi","Lordi","ABBA"]`, `["ABBA"]`, `["ABBA"]`, `broken`}, nil
+			},
+		},
+		NewBus(),
+		Event{},
+	)
+
+	results, err := svc.GetResults(MethodBorda)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := Results{
+		State:  Open,
+		Method: MethodBorda,
+		Standings: []Standing{
+			{Place: 1, Name: "ABBA", Points: 2, Votes: 2},
+			{Place: 2, Name: "Lordi", Points: 1, Votes: 1},
+		},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Results: %+v, expected %+v", results, expected)
+	}
+
+	if _, err = svc.GetResults("condorcet"); err != ErrUnknownMethod {
+		t.Errorf("Error: %v, expected %v", err, ErrUnknownMethod)
+	}
+}
+
+func TestGetResultsCachesTallies(t *testing.T) {
+	var (
+		state      = string(Open)
+		candidates = []string{"ABBA", "Lordi"}
+		reads      int
+		now        = time.Date(2017, 5, 13, 21, 0, 0, 0, time.UTC)
+	)
+
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: func() (string, error) {
+				return state, nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return append([]string(nil), candidates...), nil
+			},
+			GetBallotsFunc: func() ([]string, error) {
+				reads++
+				return []string{`["ABBA","Lordi"]`}, nil
+			},
+		},
+		NewBus(),
+		Event{},
+	)
+	svc.now = func() time.Time { return now }
+
+	cases := []struct {
+		advance    time.Duration
+		state      State
+		candidates []string
+		reads      int
+	}{
+		{0, Open, []string{"ABBA", "Lordi"}, 1},
+		{time.Second, Open, []string{"Lordi", "ABBA"}, 1},
+		{tallyTTL, Open, []string{"ABBA", "Lordi"}, 2},
+		{0, Closed, []string{"ABBA", "Lordi"}, 3},
+		{24 * time.Hour, Closed, []string{"ABBA", "Lordi"}, 3},
+		// Candidate is added after closing.
+		{time.Second, Closed, []string{"ABBA", "Lordi", "Loreen"}, 4},
+		{time.Second, Closed, []string{"ABBA", "Lordi", "Loreen"}, 4},
+	}
+
+	for i, c := range cases {
+		now, state, candidates = now.Add(c.advance), string(c.state), c.candidates
+
+		results, err := svc.GetResults(MethodIRV)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		if results.State != c.state || reads != c.reads {
+			t.Errorf("Request #%d: state %q, ballots read %d times, expected %q and %d", i+1, results.State, reads, c.state, c.reads)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package voting
+
+// Update is a message sent to WebSocket subscribers. Subscriber gets full snapshot first,
+// next updates carry only counters of candidates, countries, operators and types of numbers that changed since previous one.
+// Seq grows by one with every update, gap in sequence means that subscriber missed an update.
+type Update struct {
+	Seq  uint64
+	Full bool
+	Stats
+}
+
+// nextUpdate builds update that follows the one with given sequence number and stats.
+// The very first update is a full snapshot. Returns false if nothing changed.
+func nextUpdate(prev, curr Stats, seq uint64) (Update, bool) {
+	update := Update{Seq: seq + 1, Full: true, Stats: curr}
+
+	if seq == 0 {
+		return update, true
+	}
+
+	d, ok := diffStats(prev, curr)
+	if !ok {
+		return update, true
+	}
+
+	if d.isEmpty(prev) {
+		return Update{}, false
+	}
+
+	update.Full, update.Stats = false, d
+
+	return update, true
+}
+
+// diffStats returns stats with only those items which counters differ between snapshots.
+// Returns false if set of candidates, countries, operators or types changed, full snapshot must be sent then.
+// The same goes for candidates within each country.
+func diffStats(prev, curr Stats) (Stats, bool) {
+	d := curr
+
+	for _, items := range []struct {
+		prev, curr []StatItem
+		diff       *[]StatItem
+	}{
+		{prev.Candidates, curr.Candidates, &d.Candidates},
+		{prev.Countries, curr.Countries, &d.Countries},
+		{prev.Operators, curr.Operators, &d.Operators},
+		{prev.Types, curr.Types, &d.Types},
+	} {
+		changed, ok := diffItems(items.prev, items.curr)
+		if !ok {
+			return curr, false
+		}
+		*items.diff = changed
+	}
+
+	matrix, ok := diffMatrix(prev.ByCountry, curr.ByCountry)
+	if !ok {
+		return curr, false
+	}
+	d.ByCountry = matrix
+
+	return d, true
+}
+
+// diffMatrix returns only countries where scores of candidates changed, each with changed items only.
+// Returns false if countries or candidates within any of them were added or removed.
+func diffMatrix(prev, curr map[string][]StatItem) (map[string][]StatItem, bool) {
+	if len(prev) != len(curr) {
+		return nil, false
+	}
+
+	var changed map[string][]StatItem
+
+	for code, items := range curr {
+		prevItems, ok := prev[code]
+		if !ok {
+			return nil, false
+		}
+
+		diff, ok := diffItems(prevItems, items)
+		if !ok {
+			return nil, false
+		}
+
+		if len(diff) > 0 {
+			if changed == nil {
+				changed = make(map[string][]StatItem)
+			}
+			changed[code] = diff
+		}
+	}
+
+	return changed, true
+}
+
+// diffItems returns items which values changed. Returns false if items were added or removed.
+func diffItems(prev, curr []StatItem) ([]StatItem, bool) {
+	if len(prev) != len(curr) {
+		return nil, false
+	}
+
+	values := make(map[string]int, len(prev))
+	for _, it := range prev {
+		values[it.Name] = it.Value
+	}
+
+	var changed []StatItem
+
+	for _, it := range curr {
+		v, ok := values[it.Name]
+		if !ok {
+			return nil, false
+		}
+		if v != it.Value {
+			changed = append(changed, it)
+		}
+	}
+
+	return changed, true
+}
+
+// isEmpty checks if delta carries no changes compared to previous snapshot.
+func (d Stats) isEmpty(prev Stats) bool {
+	return len(d.Candidates) == 0 && len(d.Countries) == 0 &&
+		len(d.Operators) == 0 && len(d.Types) == 0 && len(d.ByCountry) == 0 &&
+		d.State == prev.State &&
+		d.Invalid == prev.Invalid &&
+		d.Rejected == prev.Rejected &&
+		d.Early == prev.Early &&
+		d.Late == prev.Late &&
+		d.Delivery == prev.Delivery
+}
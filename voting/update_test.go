@@ -0,0 +1,86 @@
+package voting
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNextUpdate(t *testing.T) {
+	first := Stats{
+		State:      Open,
+		Candidates: []StatItem{{"ABBA", 1}, {"Lordi", 2}},
+		Countries:  []StatItem{{"UKR", 3}},
+		Operators:  []StatItem{{"Kyivstar", 2}, {"N/A", 1}},
+		ByCountry:  map[string][]StatItem{"UKR": {{"Lordi", 1}, {"ABBA", 1}}},
+	}
+
+	update, changed := nextUpdate(Stats{}, first, 0)
+	if !changed || !update.Full || update.Seq != 1 {
+		t.Errorf("First update is %+v, expected full snapshot with sequence number 1", update)
+	}
+
+	if _, changed = nextUpdate(first, first, 1); changed {
+		t.Error("Update produced, expected nothing to change.")
+	}
+
+	second := Stats{
+		State:      Open,
+		Candidates: []StatItem{{"ABBA", 1}, {"Lordi", 3}},
+		Countries:  []StatItem{{"UKR", 4}},
+		Operators:  []StatItem{{"Kyivstar", 3}, {"N/A", 1}},
+		ByCountry:  map[string][]StatItem{"UKR": {{"Lordi", 2}, {"ABBA", 1}}},
+	}
+
+	update, changed = nextUpdate(first, second, 1)
+	if !changed || update.Full || update.Seq != 2 {
+		t.Errorf("Update is %+v, expected delta with sequence number 2", update)
+	}
+
+	if !reflect.DeepEqual(update.Candidates, []StatItem{{"Lordi", 3}}) {
+		t.Errorf("Candidates in delta: %v, expected only Lordi", update.Candidates)
+	}
+
+	if !reflect.DeepEqual(update.Operators, []StatItem{{"Kyivstar", 3}}) {
+		t.Errorf("Operators in delta: %v, expected only Kyivstar", update.Operators)
+	}
+
+	expected := map[string][]StatItem{"UKR": {{"Lordi", 2}}}
+	if !reflect.DeepEqual(update.ByCountry, expected) {
+		t.Errorf("Matrix in delta: %v, expected %v", update.ByCountry, expected)
+	}
+
+	third := Stats{
+		State:      Open,
+		Candidates: []StatItem{{"ABBA", 1}, {"Lordi", 3}, {"Loreen", 0}},
+		Countries:  []StatItem{{"UKR", 4}},
+		Operators:  second.Operators,
+		ByCountry:  second.ByCountry,
+	}
+
+	update, changed = nextUpdate(second, third, 2)
+	if !changed || !update.Full || len(update.Candidates) != 3 {
+		t.Errorf("Update is %+v, expected full snapshot after candidate was added", update)
+	}
+
+	update, changed = nextUpdate(third, Stats{State: Closed, Candidates: third.Candidates, Countries: third.Countries, Operators: third.Operators, ByCountry: third.ByCountry}, 3)
+	if !changed || update.Full || update.State != Closed {
+		t.Errorf("Update is %+v, expected delta with new state", update)
+	}
+}
+
+func TestBusCoalescesNotifications(t *testing.T) {
+	bus := NewBus()
+	changes := bus.Subscribe("Eurovision")
+
+	bus.Publish("Eurovision")
+	bus.Publish("Eurovision")
+	bus.Publish("Other")
+
+	<-changes
+
+	select {
+	case <-changes:
+		t.Error("Got second notification, expected them to be coalesced.")
+	default:
+	}
+}
@@ -1,6 +1,14 @@
 package voting
 
-import "log"
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bilinguliar/gokiezen/score"
+)
 
 const unresolved = "N/A"
 
@@ -11,9 +19,36 @@ type StatItem struct {
 }
 
 // Stats holds collections of StatItems.
+// Operator and type are known only for voters resolved by paid lookup, others are counted as N/A.
+// Once event is closed, results are frozen. Only counters of votes outside of voting window and delivery of replies keep changing.
 type Stats struct {
+	State      State
 	Candidates []StatItem
 	Countries  []StatItem
+	ByCountry  map[string][]StatItem // Scores of candidates within each country, keyed by country code.
+	Operators  []StatItem            // Votes by mobile operator of the voter, N/A if it is not known.
+	Types      []StatItem            // Votes by type of number: mobile, fixed, voip, other or N/A if it is not known.
+	Invalid    int                   // Votes sent for candidates that are not registered.
+	Rejected   int                   // Votes rejected because voter exceeded the limit.
+	Early      int                   // Votes sent before event was opened.
+	Late       int                   // Votes sent after event was closed.
+	Delivery   Delivery
+}
+
+// Delivery counts replies sent to voters by their last known status.
+type Delivery struct {
+	Queued    int
+	Sent      int // Accepted by provider, delivery is not confirmed yet.
+	Delivered int
+	Failed    int
+	Rate      float64 // Share of delivered replies among those with final status.
+}
+
+// Policy limits number of votes that can be cast from single MSISDN. Zero limit means no limit.
+type Policy struct {
+	PerVoter     int  // Max votes from single MSISDN in total. Ignored if last vote wins, voter has single vote then.
+	PerCandidate int  // Max votes from single MSISDN for the same candidate.
+	LastVoteWins bool // Only the most recent vote of MSISDN counts, it replaces previous one.
 }
 
 // Voting is a service that holds all business logic required to run voting.
@@ -21,81 +56,252 @@ type Voting struct {
 	messenger Messenger
 	enquirer  Enquirer
 	scoreKpr  ScoreKeeper
-	event     string
+	publisher Publisher
+	matcher   *Matcher
+	event     Event
+	now       func() time.Time
+	tallies   tallies
 }
 
-// Messenger is used to send text messages.
+// Messenger is used to send text messages. Messages are counted by delivery status within given event.
 type Messenger interface {
-	RequestSMS(sender, msisdn, text string)
+	RequestSMS(event, sender, msisdn, text string)
 }
 
-// Enquirer is used to resolve Country by MSISDN.
+// SubscriberInfo holds what is known about MSISDN. Fields that could not be resolved are empty.
+// Offline lookup tells only country, operator and type are known if provider lookup was asked as well.
+type SubscriberInfo struct {
+	Country  string
+	Operator string
+	Type     string
+}
+
+// Enquirer is used to resolve Country, operator and type of number by MSISDN.
 type Enquirer interface {
-	Lookup(msisdn string) (string, error)
+	Lookup(msisdn string) (SubscriberInfo, error)
 }
 
 // ScoreKeeper persists score and stats, returns results.
 type ScoreKeeper interface {
-	AddPoint(participant string) error
-	AddCountry(name string) error
+	VoteKeeper
+	StatsKeeper
+	StateKeeper
+	DeliveryCounter
+}
+
+// VoteKeeper records votes and everything needed to tell which candidate the vote is for.
+// Outcome of recording is one of score.VoteRecorded, score.VoteRejected or score.VoteClosed.
+type VoteKeeper interface {
+	RecordVote(v score.Vote) (string, error)
+	ReplaceVote(v score.Vote) (string, string, error)
+	GetBallots() ([]string, error)
+	IsCandidate(name string) (bool, error)
+	GetAliases() (map[string]string, error)
+	AddInvalidVote() error
+	AddRejectedVote() error
+}
+
+// StatsKeeper reads counters that live stats are built from.
+type StatsKeeper interface {
+	GetInvalidVotes() (int, error)
+	GetRejectedVotes() (int, error)
 	GetAllCandidates() ([]string, error)
 	GetAllCountries() ([]string, error)
-	Get(key string) (int, error)
+	GetCandidateScores(participants []string) (map[string]int, error)
+	GetCountryScores(codes []string) (map[string]int, error)
+	GetCountryCandidates(codes []string) (map[string]map[string]int, error)
+	GetAllOperators() ([]string, error)
+	GetOperatorScores(names []string) (map[string]int, error)
+	GetAllTypes() ([]string, error)
+	GetTypeScores(types []string) (map[string]int, error)
 }
 
-// New constructs Voting service instance initialized with all dependencies.
-func New(m Messenger, en Enquirer, sk ScoreKeeper, ev string) *Voting {
+// StateKeeper persists lifecycle of the event, results frozen at closing and votes sent outside of voting window.
+type StateKeeper interface {
+	GetState() (string, error)
+	SetState(state string) error
+	FreezeResults(data string) error
+	GetFrozenResults() (string, error)
+	AddEarlyVote() error
+	GetEarlyVotes() (int, error)
+	AddLateVote() error
+	GetLateVotes() (int, error)
+}
+
+// DeliveryCounter counts replies of the event by delivery status.
+type DeliveryCounter interface {
+	GetDelivery() (map[string]int, error)
+}
+
+// New constructs Voting service instance initialized with all dependencies and rules of the event.
+func New(m Messenger, en Enquirer, sk ScoreKeeper, pub Publisher, ev Event) *Voting {
 	return &Voting{
 		messenger: m,
 		enquirer:  en,
 		scoreKpr:  sk,
+		publisher: pub,
+		matcher:   NewMatcher(ev.MaxDistance),
 		event:     ev,
+		now:       time.Now,
 	}
 }
 
-// RegisterVote increments votes counter for participant and also keeps track of number of votes for each country.
-func (s *Voting) RegisterVote(msisdn, cand string) error {
-	log.Printf("Got new message: %q from MSISDN: %q", cand, msisdn)
-	var (
-		country string
-		err     error
-	)
+// RegisterVote increments votes counter for participant and also keeps track of number of votes for each country,
+// mobile operator and type of number.
+// Text of the message is matched against registered candidates, their aliases and short codes.
+// Message can rank several candidates, "ABBA, Lordi, Loreen": the first one gets the vote, whole ballot is stored for tallying.
+// Every vote changes some counter, even if it was not accepted, so subscribers are notified in any case.
+func (s *Voting) RegisterVote(msisdn, text string) error {
+	log.Printf("Got new message: %q from MSISDN: %q", text, msisdn)
+	var err error
+
+	defer s.publisher.Publish(s.event.ID)
 
-	if cand == "" {
+	if text == "" {
 		log.Println("Voter sent blank SMS, score not changed.")
-		s.messenger.RequestSMS(s.event, msisdn, "Please specify candidate's name to actually vote.")
+		s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, "Please specify candidate's name to actually vote.")
 		return nil
 	}
 
-	err = s.scoreKpr.AddPoint(cand)
-	if err != nil {
-		log.Println("Point was not added to participant's score, error:", err)
+	if open, err := s.acceptsVotes(msisdn); !open {
 		return err
 	}
 
-	country, err = s.enquirer.Lookup(msisdn)
-	if err != nil {
-		log.Printf("Country lookup failed for MSISDN: %q, error: %q", msisdn, err)
-		country = unresolved
+	ballot, err := s.resolveBallot(msisdn, text)
+	if err != nil || len(ballot) == 0 {
+		return err
 	}
 
-	err = s.scoreKpr.AddCountry(country)
+	var (
+		cand    = ballot[0]
+		sub     = s.lookup(msisdn)
+		policy  = s.event.Policy
+		outcome string
+		prev    string
+		vote    = score.Vote{
+			Candidate:    cand,
+			Country:      sub.Country,
+			Operator:     sub.Operator,
+			Type:         sub.Type,
+			MSISDN:       msisdn,
+			Ballot:       ballot.encode(),
+			PerVoter:     policy.PerVoter,
+			PerCandidate: policy.PerCandidate,
+		}
+	)
+
+	// Limits are checked by ScoreKeeper together with recording, so parallel votes of the same voter can not exceed them.
+	if policy.LastVoteWins {
+		outcome, prev, err = s.scoreKpr.ReplaceVote(vote)
+	} else {
+		outcome, err = s.scoreKpr.RecordVote(vote)
+	}
 	if err != nil {
-		log.Printf("Failed to assure contry with code: %q is present in countries set. Error: %q", country, err)
+		log.Println("Vote was not recorded, error:", err)
+		return err
 	}
 
-	// Here just recording stats, so if failed - no big deal, candidates's vote is there already.
-	if err = s.scoreKpr.AddPoint(country); err != nil {
-		log.Println("Country counter was not incremented, error:", err)
+	if outcome == score.VoteClosed {
+		s.refuseVote(msisdn, Closed)
+		return nil
 	}
 
-	s.messenger.RequestSMS(s.event, msisdn, "Thanks for your vote!")
+	if outcome == score.VoteRejected {
+		log.Printf("MSISDN: %q exceeded votes limit, vote rejected.", msisdn)
+		if err = s.scoreKpr.AddRejectedVote(); err != nil {
+			log.Println("Rejected votes counter was not incremented, error:", err)
+		}
+		s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, "Sorry, you have used all your votes.")
+		return nil
+	}
+
+	if prev != "" {
+		s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, "Your vote was changed to "+cand+".")
+		return nil
+	}
+
+	s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, "Thanks for your vote!")
 
 	return nil
 }
 
-// GetStats returns voting statistics for each participant and distribution by countries.
+// lookup resolves voter's MSISDN. Whatever could not be resolved is counted as unresolved.
+func (s *Voting) lookup(msisdn string) SubscriberInfo {
+	sub, err := s.enquirer.Lookup(msisdn)
+	if err != nil {
+		log.Printf("Lookup failed for MSISDN: %q, error: %q", msisdn, err)
+		sub = SubscriberInfo{}
+	}
+
+	for _, field := range []*string{&sub.Country, &sub.Operator, &sub.Type} {
+		if *field == "" {
+			*field = unresolved
+		}
+	}
+
+	return sub
+}
+
+// GetStats returns voting statistics for each participant and distribution by countries, operators and types of numbers.
+// Results of closed event are returned as they were at the moment of closing.
 func (s *Voting) GetStats() (Stats, error) {
+	state, err := s.State()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var stats Stats
+
+	if state == Closed || state == Archived {
+		stats, err = s.frozenStats()
+	} else {
+		stats, err = s.liveStats()
+	}
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats.State = state
+
+	if stats.Early, err = s.scoreKpr.GetEarlyVotes(); err != nil {
+		log.Println("Failed to get number of early votes, error:", err)
+		stats.Early = -1
+	}
+
+	if stats.Late, err = s.scoreKpr.GetLateVotes(); err != nil {
+		log.Println("Failed to get number of late votes, error:", err)
+		stats.Late = -1
+	}
+
+	stats.Delivery = s.delivery()
+
+	return stats, nil
+}
+
+// delivery reads counters of replies. Replies are sent after event is closed as well, so they are never frozen.
+func (s *Voting) delivery() Delivery {
+	counts, err := s.scoreKpr.GetDelivery()
+	if err != nil {
+		log.Println("Failed to get delivery counters, error:", err)
+		return Delivery{Queued: -1, Sent: -1, Delivered: -1, Failed: -1}
+	}
+
+	d := Delivery{
+		Queued:    counts["queued"],
+		Sent:      counts["sent"],
+		Delivered: counts["delivered"],
+		Failed:    counts["failed"],
+	}
+
+	if final := d.Delivered + d.Failed; final > 0 {
+		d.Rate = float64(d.Delivered) / float64(final)
+	}
+
+	return d
+}
+
+// liveStats reads current values of all counters.
+func (s *Voting) liveStats() (Stats, error) {
 	candidates, err := s.scoreKpr.GetAllCandidates()
 	if err != nil {
 		log.Println("Failed to retrieve set of all candidates, error:", err)
@@ -108,22 +314,170 @@ func (s *Voting) GetStats() (Stats, error) {
 		return Stats{}, err
 	}
 
+	operators, err := s.scoreKpr.GetAllOperators()
+	if err != nil {
+		log.Println("Failed to retrieve set of all operators, error:", err)
+		return Stats{}, err
+	}
+
+	types, err := s.scoreKpr.GetAllTypes()
+	if err != nil {
+		log.Println("Failed to retrieve set of all number types, error:", err)
+		return Stats{}, err
+	}
+
+	invalid, err := s.scoreKpr.GetInvalidVotes()
+	if err != nil {
+		log.Println("Failed to get number of invalid votes, error:", err)
+		invalid = -1
+	}
+
+	rejected, err := s.scoreKpr.GetRejectedVotes()
+	if err != nil {
+		log.Println("Failed to get number of rejected votes, error:", err)
+		rejected = -1
+	}
+
 	return Stats{
-		Candidates: s.populateStatItems(candidates),
-		Countries:  s.populateStatItems(countries),
+		Candidates: populateStatItems(candidates, s.scoreKpr.GetCandidateScores),
+		Countries:  populateStatItems(countries, s.scoreKpr.GetCountryScores),
+		ByCountry:  s.countryMatrix(countries),
+		Operators:  populateStatItems(operators, s.scoreKpr.GetOperatorScores),
+		Types:      populateStatItems(types, s.scoreKpr.GetTypeScores),
+		Invalid:    invalid,
+		Rejected:   rejected,
 	}, nil
 }
 
-// populateStatItems checks counter read for every key and then returns slice with all resolved values.
-// If there was an error reading single counter we use -1 as temporary value.
-// We assume that this will not happen during next update. And we still able to show other values.
-func (s *Voting) populateStatItems(keys []string) []StatItem {
+// frozenStats returns results saved when event was closed.
+// If they were not saved for some reason, current values are frozen now.
+func (s *Voting) frozenStats() (Stats, error) {
+	data, err := s.scoreKpr.GetFrozenResults()
+	if err != nil {
+		log.Println("Failed to get frozen results, error:", err)
+		return Stats{}, err
+	}
+
+	if data == "" {
+		return s.freeze()
+	}
+
+	var stats Stats
+	if err = json.Unmarshal([]byte(data), &stats); err != nil {
+		log.Println("Frozen results are broken, error:", err)
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// freeze saves current results, they will not change after event is closed.
+func (s *Voting) freeze() (Stats, error) {
+	stats, err := s.liveStats()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if err = s.scoreKpr.FreezeResults(string(data)); err != nil {
+		log.Println("Failed to freeze results, error:", err)
+		return Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// resolveCandidate finds registered candidate that SMS text refers to.
+// Exact name is checked first, it is the cheapest option. Otherwise text is matched against all candidates and aliases.
+// Returns empty name if vote must not be counted, voter is notified about the reason.
+func (s *Voting) resolveCandidate(msisdn, text string) (string, error) {
+	registered, err := s.scoreKpr.IsCandidate(text)
+	if err != nil {
+		log.Println("Failed to check if candidate is registered, error:", err)
+		return "", err
+	}
+
+	if registered {
+		return text, nil
+	}
+
+	candidates, aliases, err := s.candidates()
+	if err != nil {
+		return "", err
+	}
+
+	cand, options := s.matcher.Match(text, candidates, aliases)
+	if cand != "" {
+		log.Printf("Message: %q matched candidate: %q", text, cand)
+		return cand, nil
+	}
+
+	if len(options) > 0 {
+		log.Printf("Message: %q is ambiguous, asking voter to clarify.", text)
+		s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, "Did you mean "+strings.Join(options, " or ")+"? Please send the name again.")
+		return "", nil
+	}
+
+	log.Printf("Vote for unknown candidate: %q, counted as invalid.", text)
+	if err = s.scoreKpr.AddInvalidVote(); err != nil {
+		log.Println("Invalid votes counter was not incremented, error:", err)
+	}
+	s.messenger.RequestSMS(s.event.ID, s.event.Sender, msisdn, unknownCandidateReply(candidates))
+
+	return "", nil
+}
+
+// candidates reads all registered candidates and their aliases, text of the message is matched against them.
+// Failure to read aliases is not an error, candidates can still be matched by their names.
+func (s *Voting) candidates() ([]string, map[string]string, error) {
+	candidates, err := s.scoreKpr.GetAllCandidates()
+	if err != nil {
+		log.Println("Failed to retrieve set of all candidates, error:", err)
+		return nil, nil, err
+	}
+
+	aliases, err := s.scoreKpr.GetAliases()
+	if err != nil {
+		log.Println("Failed to retrieve aliases, error:", err)
+	}
+
+	return candidates, aliases, nil
+}
+
+// unknownCandidateReply builds reply for a voter that misspelled candidate's name.
+// Lists all valid candidates so the voter can try again.
+func unknownCandidateReply(candidates []string) string {
+	if len(candidates) == 0 {
+		return "Unknown candidate. Please check the name and vote again."
+	}
+
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	return "Unknown candidate. Please vote for one of: " + strings.Join(sorted, ", ") + "."
+}
+
+// populateStatItems reads counters of all keys at once and then returns slice with all resolved values.
+// If counters could not be read we use -1 as temporary value.
+// We assume that this will not happen during next update.
+func populateStatItems(keys []string, get func(keys []string) (map[string]int, error)) []StatItem {
 	results := make([]StatItem, 0, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+
+	scores, err := get(keys)
+	if err != nil {
+		log.Printf("Failed to get scores for %d keys, error: %q", len(keys), err)
+	}
 
 	for _, k := range keys {
-		v, err := s.scoreKpr.Get(k)
-		if err != nil {
-			log.Printf("Failed to get score for key: %q, error: %q", k, err)
+		v, ok := scores[k]
+		if !ok {
 			// handle -1 as temporary unresolvable on client,
 			// most likely we will get proper value during next update.
 			v = -1
@@ -2,44 +2,46 @@ package voting
 
 import (
 	"errors"
+	"reflect"
 	"testing"
+
+	"github.com/bilinguliar/gokiezen/score"
 )
 
 func TestRegisterVote(t *testing.T) {
 	stats := make(map[string]int)
 	countries := make(map[string]bool)
+	origins := make(map[string]string)
 	messages := make(map[string]string)
 
 	svc := New(
 		&MessengerMock{
-			RequestSMSFunc: func(originator, recipient, text string) {
+			RequestSMSFunc: func(event, originator, recipient, text string) {
 				messages[recipient] = text
 			},
 		},
 		&EnquirerMock{
-			LookupFunc: func(msisdn string) (string, error) {
-				var country string
-
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
 				switch msisdn[:3] {
 				case "380":
-					country = "UKR"
+					return SubscriberInfo{Country: "UKR", Operator: "Kyivstar", Type: "mobile"}, nil
 				case "310":
-					country = "NLD"
+					return SubscriberInfo{Country: "NLD"}, nil
 				default:
-					return "", errors.New("lookup failed")
+					return SubscriberInfo{}, errors.New("lookup failed")
 				}
-
-				return country, nil
 			},
 		},
 		&SkoreKprMock{
-			AddPointFunc: func(key string) error {
-				stats[key]++
-				return nil
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				stats[v.Candidate]++
+				countries[v.Country] = true
+				origins[v.MSISDN] = v.Operator + "/" + v.Type
+				return score.VoteRecorded, nil
 			},
-			AddCountryFunc: func(code string) error {
-				countries[code] = true
-				return nil
+			IsCandidateFunc: func(name string) (bool, error) {
+				return true, nil
 			},
 			GetAllCandidatesFunc: func() ([]string, error) {
 				return nil, nil
@@ -47,11 +49,22 @@ func TestRegisterVote(t *testing.T) {
 			GetAllCountriesFunc: func() ([]string, error) {
 				return nil, nil
 			},
-			GetFunc: func(key string) (int, error) {
-				return stats[key], nil
+			GetAllOperatorsFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetAllTypesFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetCandidateScoresFunc: func(names []string) (map[string]int, error) {
+				scores := make(map[string]int)
+				for _, n := range names {
+					scores[n] = stats[n]
+				}
+				return scores, nil
 			},
 		},
-		"EuroVision",
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2},
 	)
 
 	msisdn := "380661234567"
@@ -79,14 +92,701 @@ func TestRegisterVote(t *testing.T) {
 	if _, ok := countries["NLD"]; !ok {
 		t.Error("NDL was not resolved by MSISDN")
 	}
+
+	// Operator and type that enquirer does not tell are counted as unresolved.
+	expected := map[string]string{msisdn: "Kyivstar/mobile", msisdn2: unresolved + "/" + unresolved}
+	if !reflect.DeepEqual(origins, expected) {
+		t.Errorf("Operators and types: %v, expected %v", origins, expected)
+	}
+}
+
+func TestRegisterVoteMatchesMisspelledCandidate(t *testing.T) {
+	stats := make(map[string]int)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				stats[v.Candidate]++
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return name == "ABBA", nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return []string{"ABBA", "Lordi"}, nil
+			},
+			GetAliasesFunc: func() (map[string]string, error) {
+				return map[string]string{"2": "Lordi"}, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 1},
+	)
+
+	for _, text := range []string{"abba!", "ABA", "2"} {
+		if err := svc.RegisterVote("380661234567", text); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	if stats["ABBA"] != 2 {
+		t.Errorf("Score for ABBA is %d, expected %d", stats["ABBA"], 2)
+	}
+
+	if stats["Lordi"] != 1 {
+		t.Errorf("Score for Lordi is %d, expected %d", stats["Lordi"], 1)
+	}
+}
+
+func TestRegisterVoteStoresRankedBallot(t *testing.T) {
+	var (
+		votes   []string
+		ballots []string
+	)
+
+	candidates := []string{"ABBA", "Lordi", "Ding, Dong"}
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				votes = append(votes, v.Candidate)
+				ballots = append(ballots, v.Ballot)
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				for _, c := range candidates {
+					if c == name {
+						return true, nil
+					}
+				}
+				return false, nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return candidates, nil
+			},
+			GetAliasesFunc: func() (map[string]string, error) {
+				return map[string]string{"2": "Lordi"}, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 1},
+	)
+
+	for _, text := range []string{"ABBA, 2; abba", "Ding, Dong", "Lordi"} {
+		if err := svc.RegisterVote("380661234567", text); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	expectedVotes := []string{"ABBA", "Ding, Dong", "Lordi"}
+	if !reflect.DeepEqual(votes, expectedVotes) {
+		t.Errorf("Votes: %q, expected %q", votes, expectedVotes)
+	}
+
+	expectedBallots := []string{`["ABBA","Lordi"]`, `["Ding, Dong"]`, `["Lordi"]`}
+	if !reflect.DeepEqual(ballots, expectedBallots) {
+		t.Errorf("Ballots: %q, expected %q", ballots, expectedBallots)
+	}
+}
+
+func TestRegisterVoteRepliesOnceForUnresolvedBallot(t *testing.T) {
+	var (
+		replies []string
+		invalid int
+		reads   int
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				replies = append(replies, text)
+			},
+		},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				t.Errorf("Vote recorded for %q, expected ballot to be refused.", v.Candidate)
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return false, nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				reads++
+				return []string{"Lina", "Lena", "ABBA"}, nil
+			},
+			GetAliasesFunc: func() (map[string]string, error) {
+				return nil, nil
+			},
+			AddInvalidVoteFunc: func() error {
+				invalid++
+				return nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 1},
+	)
+
+	if err := svc.RegisterVote("380661234567", "Abba, Queen, Lna, Muse"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	expected := []string{"Unknown candidates: Queen, Muse. Did you mean Lena or Lina instead of Lna? Please vote for some of: ABBA, Lena, Lina."}
+	if !reflect.DeepEqual(replies, expected) {
+		t.Errorf("Replies: %q, expected %q", replies, expected)
+	}
+
+	if invalid != 1 || reads != 1 {
+		t.Errorf("Invalid votes: %d, candidates read %d times, expected 1 and 1", invalid, reads)
+	}
+}
+
+func TestRegisterVoteAsksToClarifyAmbiguousName(t *testing.T) {
+	var reply string
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				t.Errorf("Vote recorded for %q, expected voter to be asked.", v.Candidate)
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return false, nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return []string{"Lena", "Lina"}, nil
+			},
+			GetAliasesFunc: func() (map[string]string, error) {
+				return nil, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 1},
+	)
+
+	if err := svc.RegisterVote("380661234567", "Lna"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	expected := "Did you mean Lena or Lina? Please send the name again."
+	if reply != expected {
+		t.Errorf("Reply is %q, expected %q", reply, expected)
+	}
+}
+
+func TestRegisterVoteForUnknownCandidateIsInvalid(t *testing.T) {
+	var (
+		invalid int
+		reply   string
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				t.Errorf("Vote recorded for %q, expected vote to be rejected.", v.Candidate)
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return name == "ABBA" || name == "Lordi", nil
+			},
+			GetAliasesFunc: func() (map[string]string, error) {
+				return nil, nil
+			},
+			AddInvalidVoteFunc: func() error {
+				invalid++
+				return nil
+			},
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return []string{"Lordi", "ABBA"}, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2},
+	)
+
+	err := svc.RegisterVote("380661234567", "Queen")
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if invalid != 1 {
+		t.Errorf("Invalid votes: %d, expected %d", invalid, 1)
+	}
+
+	expected := "Unknown candidate. Please vote for one of: ABBA, Lordi."
+	if reply != expected {
+		t.Errorf("Reply is %q, expected %q", reply, expected)
+	}
+}
+
+func TestGetStatsReportsInvalidRejectedVotesAndDelivery(t *testing.T) {
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetAllCountriesFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetAllOperatorsFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetAllTypesFunc: func() ([]string, error) {
+				return nil, nil
+			},
+			GetInvalidVotesFunc: func() (int, error) {
+				return 7, nil
+			},
+			GetRejectedVotesFunc: func() (int, error) {
+				return 3, nil
+			},
+			GetEarlyVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetLateVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetDeliveryFunc: func() (map[string]int, error) {
+				return map[string]int{"sent": 2, "delivered": 6, "failed": 2}, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2},
+	)
+
+	stats, err := svc.GetStats()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if stats.Invalid != 7 {
+		t.Errorf("Invalid votes: %d, expected %d", stats.Invalid, 7)
+	}
+
+	if stats.Rejected != 3 {
+		t.Errorf("Rejected votes: %d, expected %d", stats.Rejected, 3)
+	}
+
+	expected := Delivery{Sent: 2, Delivered: 6, Failed: 2, Rate: 0.75}
+	if stats.Delivery != expected {
+		t.Errorf("Delivery: %+v, expected %+v", stats.Delivery, expected)
+	}
+}
+
+func TestGetStatsReadsScoresAtOnce(t *testing.T) {
+	calls := 0
+
+	svc := New(
+		&MessengerMock{},
+		&EnquirerMock{},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			GetAllCandidatesFunc: func() ([]string, error) {
+				return []string{"ABBA", "Lordi"}, nil
+			},
+			GetAllCountriesFunc: func() ([]string, error) {
+				return []string{"UKR", "NLD"}, nil
+			},
+			GetCandidateScoresFunc: func(names []string) (map[string]int, error) {
+				calls++
+				return map[string]int{"ABBA": 5, "Lordi": 2}, nil
+			},
+			GetCountryScoresFunc: func(codes []string) (map[string]int, error) {
+				calls++
+				return nil, errors.New("connection refused")
+			},
+			GetCountryCandidatesFunc: func(codes []string) (map[string]map[string]int, error) {
+				calls++
+				return map[string]map[string]int{"UKR": {"ABBA": 1, "Lordi": 2}}, nil
+			},
+			GetAllOperatorsFunc: func() ([]string, error) {
+				return []string{"Kyivstar"}, nil
+			},
+			GetOperatorScoresFunc: func(names []string) (map[string]int, error) {
+				calls++
+				return map[string]int{"Kyivstar": 4}, nil
+			},
+			GetAllTypesFunc: func() ([]string, error) {
+				return []string{"mobile", unresolved}, nil
+			},
+			GetTypeScoresFunc: func(types []string) (map[string]int, error) {
+				calls++
+				return map[string]int{"mobile": 4, unresolved: 3}, nil
+			},
+			GetInvalidVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetRejectedVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetEarlyVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetLateVotesFunc: func() (int, error) {
+				return 0, nil
+			},
+			GetDeliveryFunc: func() (map[string]int, error) {
+				return nil, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2},
+	)
+
+	stats, err := svc.GetStats()
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if calls != 5 {
+		t.Errorf("Scores were read %d times, expected %d", calls, 5)
+	}
+
+	expected := []StatItem{{"ABBA", 5}, {"Lordi", 2}}
+	if !reflect.DeepEqual(stats.Candidates, expected) {
+		t.Errorf("Candidates: %v, expected %v", stats.Candidates, expected)
+	}
+
+	// Countries could not be read, they are reported as temporary unresolvable.
+	expected = []StatItem{{"UKR", -1}, {"NLD", -1}}
+	if !reflect.DeepEqual(stats.Countries, expected) {
+		t.Errorf("Countries: %v, expected %v", stats.Countries, expected)
+	}
+
+	// Country without votes within matrix has no candidates.
+	matrix := map[string][]StatItem{"UKR": {{"Lordi", 2}, {"ABBA", 1}}, "NLD": {}}
+	if !reflect.DeepEqual(stats.ByCountry, matrix) {
+		t.Errorf("Matrix: %v, expected %v", stats.ByCountry, matrix)
+	}
+
+	expected = []StatItem{{"Kyivstar", 4}}
+	if !reflect.DeepEqual(stats.Operators, expected) {
+		t.Errorf("Operators: %v, expected %v", stats.Operators, expected)
+	}
+
+	expected = []StatItem{{"mobile", 4}, {unresolved, 3}}
+	if !reflect.DeepEqual(stats.Types, expected) {
+		t.Errorf("Types: %v, expected %v", stats.Types, expected)
+	}
+}
+
+func TestRegisterVoteRejectsVotesOverLimit(t *testing.T) {
+	var (
+		stats    = make(map[string]int)
+		voters   = make(map[string]int)
+		rejected int
+		reply    string
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				if voters[v.MSISDN] >= v.PerVoter || voters[v.MSISDN+v.Candidate] >= v.PerCandidate {
+					return score.VoteRejected, nil
+				}
+				stats[v.Candidate]++
+				voters[v.MSISDN]++
+				voters[v.MSISDN+v.Candidate]++
+				return score.VoteRecorded, nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return true, nil
+			},
+			AddRejectedVoteFunc: func() error {
+				rejected++
+				return nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2, Policy: Policy{PerVoter: 3, PerCandidate: 2}},
+	)
+
+	msisdn := "380661234567"
+
+	for _, cand := range []string{"ABBA", "ABBA", "ABBA", "Lordi", "Lordi"} {
+		if err := svc.RegisterVote(msisdn, cand); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	if stats["ABBA"] != 2 {
+		t.Errorf("Score for ABBA is %d, expected %d", stats["ABBA"], 2)
+	}
+
+	if stats["Lordi"] != 1 {
+		t.Errorf("Score for Lordi is %d, expected %d", stats["Lordi"], 1)
+	}
+
+	if rejected != 2 {
+		t.Errorf("Rejected votes: %d, expected %d", rejected, 2)
+	}
+
+	if reply != "Sorry, you have used all your votes." {
+		t.Errorf("Unexpected reply: %q", reply)
+	}
+}
+
+func TestRegisterVoteLastVoteWins(t *testing.T) {
+	var (
+		stats   = make(map[string]int)
+		last    = make(map[string][2]string)
+		replies []string
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				replies = append(replies, text)
+			},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			ReplaceVoteFunc: func(v score.Vote) (string, string, error) {
+				prev := last[v.MSISDN]
+				if prev[0] != "" {
+					stats[prev[0]]--
+					stats[prev[1]]--
+				}
+				stats[v.Candidate]++
+				stats[v.Country]++
+				last[v.MSISDN] = [2]string{v.Candidate, v.Country}
+				return score.VoteRecorded, prev[0], nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return true, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2, Policy: Policy{LastVoteWins: true}},
+	)
+
+	msisdn := "380661234567"
+
+	for _, cand := range []string{"ABBA", "Lordi", "Loreen"} {
+		if err := svc.RegisterVote(msisdn, cand); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	expected := map[string]int{"ABBA": 0, "Lordi": 0, "Loreen": 1, "UKR": 1}
+	for k, v := range expected {
+		if stats[k] != v {
+			t.Errorf("Score for %s is %d, expected %d", k, stats[k], v)
+		}
+	}
+
+	if replies[0] != "Thanks for your vote!" || replies[2] != "Your vote was changed to Loreen." {
+		t.Errorf("Unexpected replies: %q", replies)
+	}
+}
+
+func TestRegisterVoteLastVoteWinsWithinVotesLimit(t *testing.T) {
+	var (
+		replaced int
+		voters   = make(map[string]int)
+		reply    string
+	)
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				reply = text
+			},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			ReplaceVoteFunc: func(v score.Vote) (string, string, error) {
+				// Replaced vote does not count against the limit, the same way vote script does it.
+				if voters[v.MSISDN] > 0 {
+					replaced++
+					return score.VoteRecorded, "ABBA", nil
+				}
+				if voters[v.MSISDN] >= v.PerVoter {
+					return score.VoteRejected, "", nil
+				}
+				voters[v.MSISDN]++
+				return score.VoteRecorded, "", nil
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return true, nil
+			},
+			AddRejectedVoteFunc: func() error {
+				t.Error("Vote rejected, it must replace previous one.")
+				return nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2, Policy: Policy{PerVoter: 1, LastVoteWins: true}},
+	)
+
+	for _, cand := range []string{"ABBA", "Lordi", "Loreen"} {
+		if err := svc.RegisterVote("380661234567", cand); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+	}
+
+	if replaced != 2 {
+		t.Errorf("Replaced votes: %d, expected %d", replaced, 2)
+	}
+
+	if reply != "Your vote was changed to Loreen." {
+		t.Errorf("Unexpected reply: %q", reply)
+	}
+}
+
+func TestRegisterVoteReturnsErrorIfVoteWasNotRecorded(t *testing.T) {
+	errWithStorage := errors.New("connection refused")
+
+	svc := New(
+		&MessengerMock{
+			RequestSMSFunc: func(event, originator, recipient, text string) {
+				t.Errorf("Reply %q sent, vote was not recorded.", text)
+			},
+		},
+		&EnquirerMock{
+			LookupFunc: func(msisdn string) (SubscriberInfo, error) {
+				return SubscriberInfo{Country: "UKR"}, nil
+			},
+		},
+		&SkoreKprMock{
+			GetStateFunc: openState,
+			RecordVoteFunc: func(v score.Vote) (string, error) {
+				return "", errWithStorage
+			},
+			IsCandidateFunc: func(name string) (bool, error) {
+				return true, nil
+			},
+		},
+		NewBus(),
+		Event{Sender: "EuroVision", MaxDistance: 2},
+	)
+
+	if err := svc.RegisterVote("380661234567", "ABBA"); err != errWithStorage {
+		t.Error("Error differs from the one we expect.")
+	}
 }
 
 type SkoreKprMock struct {
-	AddPointFunc         func(key string) error
-	AddCountryFunc       func(name string) error
-	GetAllCandidatesFunc func() ([]string, error)
-	GetAllCountriesFunc  func() ([]string, error)
-	GetFunc              func(key string) (int, error)
+	GetStateFunc             func() (string, error)
+	SetStateFunc             func(state string) error
+	FreezeResultsFunc        func(data string) error
+	GetFrozenResultsFunc     func() (string, error)
+	AddEarlyVoteFunc         func() error
+	GetEarlyVotesFunc        func() (int, error)
+	AddLateVoteFunc          func() error
+	GetLateVotesFunc         func() (int, error)
+	GetDeliveryFunc          func() (map[string]int, error)
+	RecordVoteFunc           func(v score.Vote) (string, error)
+	ReplaceVoteFunc          func(v score.Vote) (string, string, error)
+	GetBallotsFunc           func() ([]string, error)
+	AddRejectedVoteFunc      func() error
+	GetRejectedVotesFunc     func() (int, error)
+	IsCandidateFunc          func(name string) (bool, error)
+	GetAliasesFunc           func() (map[string]string, error)
+	AddInvalidVoteFunc       func() error
+	GetInvalidVotesFunc      func() (int, error)
+	GetAllCandidatesFunc     func() ([]string, error)
+	GetAllCountriesFunc      func() ([]string, error)
+	GetCandidateScoresFunc   func(names []string) (map[string]int, error)
+	GetCountryScoresFunc     func(codes []string) (map[string]int, error)
+	GetCountryCandidatesFunc func(codes []string) (map[string]map[string]int, error)
+	GetAllOperatorsFunc      func() ([]string, error)
+	GetOperatorScoresFunc    func(names []string) (map[string]int, error)
+	GetAllTypesFunc          func() ([]string, error)
+	GetTypeScoresFunc        func(types []string) (map[string]int, error)
+}
+
+func (sk *SkoreKprMock) IsCandidate(name string) (bool, error) {
+	return sk.IsCandidateFunc(name)
+}
+
+func (sk *SkoreKprMock) GetAliases() (map[string]string, error) {
+	return sk.GetAliasesFunc()
+}
+
+func (sk *SkoreKprMock) RecordVote(v score.Vote) (string, error) {
+	return sk.RecordVoteFunc(v)
+}
+
+func (sk *SkoreKprMock) ReplaceVote(v score.Vote) (string, string, error) {
+	return sk.ReplaceVoteFunc(v)
+}
+
+func (sk *SkoreKprMock) GetBallots() ([]string, error) {
+	return sk.GetBallotsFunc()
+}
+
+func (sk *SkoreKprMock) AddRejectedVote() error {
+	return sk.AddRejectedVoteFunc()
+}
+
+func (sk *SkoreKprMock) GetRejectedVotes() (int, error) {
+	return sk.GetRejectedVotesFunc()
+}
+
+func (sk *SkoreKprMock) AddInvalidVote() error {
+	return sk.AddInvalidVoteFunc()
+}
+
+func (sk *SkoreKprMock) GetInvalidVotes() (int, error) {
+	return sk.GetInvalidVotesFunc()
 }
 
 func (sk *SkoreKprMock) GetAllCandidates() ([]string, error) {
@@ -97,30 +797,86 @@ func (sk *SkoreKprMock) GetAllCountries() ([]string, error) {
 	return sk.GetAllCountriesFunc()
 }
 
-func (sk *SkoreKprMock) Get(key string) (int, error) {
-	return sk.GetFunc(key)
+func (sk *SkoreKprMock) GetCandidateScores(names []string) (map[string]int, error) {
+	return sk.GetCandidateScoresFunc(names)
+}
+
+func (sk *SkoreKprMock) GetCountryScores(codes []string) (map[string]int, error) {
+	return sk.GetCountryScoresFunc(codes)
+}
+
+func (sk *SkoreKprMock) GetCountryCandidates(codes []string) (map[string]map[string]int, error) {
+	return sk.GetCountryCandidatesFunc(codes)
+}
+
+func (sk *SkoreKprMock) GetAllOperators() ([]string, error) {
+	return sk.GetAllOperatorsFunc()
+}
+
+func (sk *SkoreKprMock) GetOperatorScores(names []string) (map[string]int, error) {
+	return sk.GetOperatorScoresFunc(names)
+}
+
+func (sk *SkoreKprMock) GetAllTypes() ([]string, error) {
+	return sk.GetAllTypesFunc()
+}
+
+func (sk *SkoreKprMock) GetTypeScores(types []string) (map[string]int, error) {
+	return sk.GetTypeScoresFunc(types)
+}
+
+func (sk *SkoreKprMock) GetState() (string, error) {
+	return sk.GetStateFunc()
+}
+
+func (sk *SkoreKprMock) SetState(state string) error {
+	return sk.SetStateFunc(state)
+}
+
+func (sk *SkoreKprMock) FreezeResults(data string) error {
+	return sk.FreezeResultsFunc(data)
+}
+
+func (sk *SkoreKprMock) GetFrozenResults() (string, error) {
+	return sk.GetFrozenResultsFunc()
+}
+
+func (sk *SkoreKprMock) AddEarlyVote() error {
+	return sk.AddEarlyVoteFunc()
+}
+
+func (sk *SkoreKprMock) GetEarlyVotes() (int, error) {
+	return sk.GetEarlyVotesFunc()
+}
+
+func (sk *SkoreKprMock) AddLateVote() error {
+	return sk.AddLateVoteFunc()
+}
+
+func (sk *SkoreKprMock) GetLateVotes() (int, error) {
+	return sk.GetLateVotesFunc()
 }
 
-func (sk *SkoreKprMock) AddPoint(key string) error {
-	return sk.AddPointFunc(key)
+func (sk *SkoreKprMock) GetDelivery() (map[string]int, error) {
+	return sk.GetDeliveryFunc()
 }
 
-func (sk *SkoreKprMock) AddCountry(code string) error {
-	return sk.AddCountryFunc(code)
+func openState() (string, error) {
+	return string(Open), nil
 }
 
 type EnquirerMock struct {
-	LookupFunc func(msisdn string) (string, error)
+	LookupFunc func(msisdn string) (SubscriberInfo, error)
 }
 
-func (e *EnquirerMock) Lookup(msisdn string) (string, error) {
+func (e *EnquirerMock) Lookup(msisdn string) (SubscriberInfo, error) {
 	return e.LookupFunc(msisdn)
 }
 
 type MessengerMock struct {
-	RequestSMSFunc func(originator, recipient, text string)
+	RequestSMSFunc func(event, originator, recipient, text string)
 }
 
-func (mm *MessengerMock) RequestSMS(originator, recipient, text string) {
-	mm.RequestSMSFunc(originator, recipient, text)
+func (mm *MessengerMock) RequestSMS(event, originator, recipient, text string) {
+	mm.RequestSMSFunc(event, originator, recipient, text)
 }